@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// archiveMetadataKind tells the metadata document of an archive apart from the List of objects.
+const archiveMetadataKind = "SnapshotMetadata"
+
+// SnapshotMetadata records what the cluster served and what couldn't be listed when the snapshot
+// was saved, so a replay drops the same findings the live run did.
+type SnapshotMetadata struct {
+	Kind      string                                 `json:",omitempty" yaml:",omitempty"`
+	Resources map[string]schema.GroupVersionResource `json:",omitempty" yaml:",omitempty"`
+	Errors    []ReportError                          `json:",omitempty" yaml:",omitempty"`
+	// Failed lists per kind the namespaces it couldn't be listed in, blank standing for all of them.
+	Failed map[string][]string `json:",omitempty" yaml:",omitempty"`
+}
+
+// saveArchive writes the metadata of the snapshot followed by every object in it, as a JSON List,
+// to a gzip-compressed file.
+func saveArchive(snapshot *Snapshot, path string) (int, error) {
+	metadata := SnapshotMetadata{Kind: archiveMetadataKind, Resources: snapshot.resources, Errors: snapshot.errors, Failed: make(map[string][]string)}
+	for kind, namespaces := range snapshot.failed {
+		for namespace := range namespaces {
+			metadata.Failed[kind] = append(metadata.Failed[kind], namespace)
+		}
+		sort.Strings(metadata.Failed[kind])
+	}
+
+	list := v1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+
+	kinds := make([]string, 0, len(snapshot.indexers))
+	for kind := range snapshot.indexers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		for _, item := range snapshot.objects(kind) {
+			obj := item.(runtime.Object).DeepCopyObject()
+			gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+			if err != nil {
+				return 0, err
+			}
+			obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+			list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	writer := gzip.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(&metadata); err != nil {
+		return 0, err
+	}
+	if err := encoder.Encode(&list); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return len(list.Items), f.Close()
+}
+
+// loadArchive reads a snapshot written by saveArchive, keeping only the objects and failures in the
+// namespace if one is set. Archives without metadata replay like manifests.
+func loadArchive(path string, namespace string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a snapshot archive: %s", path, err.Error())
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		return nil, fmt.Errorf("%s is not a snapshot archive: %s", path, err.Error())
+	}
+	metadata := SnapshotMetadata{}
+	if err := json.Unmarshal(first, &metadata); err != nil {
+		return nil, err
+	}
+	rest := io.MultiReader(decoder.Buffered(), reader)
+	if metadata.Kind != archiveMetadataKind {
+		metadata = SnapshotMetadata{}
+		rest = io.MultiReader(bytes.NewReader(first), rest)
+	}
+
+	objects, err := readManifests(rest)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := newSnapshot(namespace)
+	for _, obj := range objects {
+		snapshot.addManifest(obj)
+	}
+
+	snapshot.resources = metadata.Resources
+	for _, reportError := range metadata.Errors {
+		if namespace == "" || reportError.Namespace == "" || reportError.Namespace == namespace {
+			snapshot.errors = append(snapshot.errors, reportError)
+		}
+	}
+	for kind, namespaces := range metadata.Failed {
+		for _, failed := range namespaces {
+			if namespace != "" && failed != "" && failed != namespace {
+				continue
+			}
+			if snapshot.failed[kind] == nil {
+				snapshot.failed[kind] = make(map[string]bool)
+			}
+			snapshot.failed[kind][failed] = true
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+const backupIndexFile = "index.yaml"
+
+type BackupEntry struct {
+	Kind      string `json:",omitempty" yaml:",omitempty"`
+	Namespace string `json:",omitempty" yaml:",omitempty"`
+	Name      string `json:",omitempty" yaml:",omitempty"`
+	UID       string `json:",omitempty" yaml:",omitempty"`
+	File      string `json:",omitempty" yaml:",omitempty"`
+	Deleted   string `json:",omitempty" yaml:",omitempty"`
+	Reason    string `json:",omitempty" yaml:",omitempty"`
+}
+
+type BackupIndex struct {
+	Items []BackupEntry `json:",omitempty" yaml:",omitempty"`
+}
+
+// stripForBackup removes the server populated fields so the manifest can be re-applied as is.
+func stripForBackup(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := obj.DeepCopy()
+	unstructured.RemoveNestedField(stripped.Object, "status")
+	for _, field := range []string{"uid", "resourceVersion", "managedFields", "creationTimestamp", "selfLink", "generation"} {
+		unstructured.RemoveNestedField(stripped.Object, "metadata", field)
+	}
+	if stripped.GetKind() == "Service" {
+		stripServiceAllocations(stripped)
+	}
+	return stripped
+}
+
+// stripServiceAllocations removes the cluster IPs and node ports the API server allocated to the
+// service. They may have been handed out again by the time the service is restored, and the server
+// defaults clusterIP from clusterIPs. Headless services have to keep theirs.
+func stripServiceAllocations(service *unstructured.Unstructured) {
+	if clusterIP, _, _ := unstructured.NestedString(service.Object, "spec", "clusterIP"); clusterIP != "None" {
+		unstructured.RemoveNestedField(service.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(service.Object, "spec", "clusterIPs")
+	}
+	unstructured.RemoveNestedField(service.Object, "spec", "healthCheckNodePort")
+	ports, found, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+	if !found {
+		return
+	}
+	for _, port := range ports {
+		if fields, ok := port.(map[string]interface{}); ok {
+			delete(fields, "nodePort")
+		}
+	}
+	unstructured.SetNestedSlice(service.Object, ports, "spec", "ports")
+}
+
+// writeBackup saves the stripped manifest of the object to the backup directory and returns the file name.
+func writeBackup(backupDir string, item PlannedDeletion, obj *unstructured.Unstructured) (string, error) {
+	data, err := yaml.Marshal(stripForBackup(obj).Object)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", err
+	}
+	file := fmt.Sprintf("%s.%s.%s.%s.yaml", item.Kind, item.Namespace, item.Name, item.UID)
+	return file, ioutil.WriteFile(filepath.Join(backupDir, file), data, 0644)
+}
+
+func readBackupIndex(backupDir string) (BackupIndex, error) {
+	index := BackupIndex{}
+	data, err := ioutil.ReadFile(filepath.Join(backupDir, backupIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	err = yaml.Unmarshal(data, &index)
+	return index, err
+}
+
+// recordBackup adds the deleted object to the backup index.
+func recordBackup(backupDir string, entry BackupEntry) error {
+	index, err := readBackupIndex(backupDir)
+	if err != nil {
+		return err
+	}
+	entry.Deleted = time.Now().UTC().Format(time.RFC3339)
+	index.Items = append(index.Items, entry)
+	data, err := yaml.Marshal(&index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(backupDir, backupIndexFile), data, 0644)
+}
+
+// restoreBackup recreates the backed up objects that match the kind, namespace and name filters.
+// Blank filters match everything.
+func restoreBackup(client dynamic.Interface, backupDir string, kind string, namespace string, name string) (restored int, failed int, err error) {
+	index, err := readBackupIndex(backupDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(index.Items) == 0 {
+		return 0, 0, fmt.Errorf("no backups found in %s", backupDir)
+	}
+
+	for _, entry := range index.Items {
+		if (kind != "" && entry.Kind != kind) || (namespace != "" && entry.Namespace != namespace) || (name != "" && entry.Name != name) {
+			continue
+		}
+		if !contains(entry.Kind, deletableKinds) {
+			fmt.Printf("FAILED %s %s/%s: unknown kind\n", entry.Kind, entry.Namespace, entry.Name)
+			failed++
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(backupDir, entry.File))
+		if err != nil {
+			fmt.Printf("FAILED %s %s/%s: %s\n", entry.Kind, entry.Namespace, entry.Name, err.Error())
+			failed++
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		err = utilyaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&obj.Object)
+		f.Close()
+		if err != nil {
+			fmt.Printf("FAILED %s %s/%s: %s\n", entry.Kind, entry.Namespace, entry.Name, err.Error())
+			failed++
+			continue
+		}
+
+		// Objects are restored at the API version they were backed up at, which may not be the
+		// version the kind is listed at.
+		resource := obj.GroupVersionKind().GroupVersion().WithResource(kindResources[entry.Kind].Resource)
+		_, err = client.Resource(resource).Namespace(entry.Namespace).Create(obj, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			fmt.Printf("SKIPPED %s %s/%s: already exists\n", entry.Kind, entry.Namespace, entry.Name)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("FAILED %s %s/%s: %s\n", entry.Kind, entry.Namespace, entry.Name, err.Error())
+			failed++
+			continue
+		}
+		fmt.Printf("RESTORED %s %s/%s\n", entry.Kind, entry.Namespace, entry.Name)
+		restored++
+	}
+	return restored, failed, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// BaselineEntry identifies a known finding. The reason is left out on purpose, it may change
+// between runs for the same underlying problem.
+type BaselineEntry struct {
+	// Cluster is the kubeconfig context of findings recorded by a multi-cluster run.
+	Cluster   string `json:",omitempty" yaml:",omitempty"`
+	Rule      string `json:",omitempty" yaml:",omitempty"`
+	Namespace string `json:",omitempty" yaml:",omitempty"`
+	Kind      string `json:",omitempty" yaml:",omitempty"`
+	Name      string `json:",omitempty" yaml:",omitempty"`
+}
+
+type Baseline struct {
+	Created string          `json:",omitempty" yaml:",omitempty"`
+	Items   []BaselineEntry `json:",omitempty" yaml:",omitempty"`
+}
+
+func baselineEntry(cluster string, violation InventoryViolation) BaselineEntry {
+	return BaselineEntry{Cluster: cluster, Rule: violation.Rule, Namespace: violation.Namespace, Kind: violation.Kind, Name: violation.Name}
+}
+
+func sortBaselineEntries(entries []BaselineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// writeBaseline records the current findings of every cluster and returns how many were recorded.
+func writeBaseline(path string, results []*validationResult) (int, error) {
+	baseline := Baseline{Created: time.Now().UTC().Format(time.RFC3339)}
+	seen := make(map[BaselineEntry]bool)
+	for _, result := range results {
+		for _, inventoryList := range result.orphans {
+			for _, violation := range inventoryList.Items {
+				entry := baselineEntry(result.cluster, violation)
+				if !seen[entry] {
+					seen[entry] = true
+					baseline.Items = append(baseline.Items, entry)
+				}
+			}
+		}
+	}
+	sortBaselineEntries(baseline.Items)
+
+	data, err := yaml.Marshal(&baseline)
+	if err != nil {
+		return 0, err
+	}
+	return len(baseline.Items), ioutil.WriteFile(path, data, 0644)
+}
+
+func readBaseline(path string) (Baseline, error) {
+	baseline := Baseline{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return baseline, err
+	}
+	err = yaml.UnmarshalStrict(data, &baseline)
+	return baseline, err
+}
+
+// applyBaseline drops the findings recorded in the baseline and returns the baseline entries that
+// weren't found anymore. Only entries the run looked for can be fixed: entries of other clusters,
+// outside the validated namespace, of disabled rules, of checkers that didn't run or of namespaces
+// their findings were dropped in are not considered fixed. Suppressed findings are still there.
+func (r *validationResult) applyBaseline(baseline Baseline, namespace string) {
+	known := make(map[BaselineEntry]bool)
+	for _, entry := range baseline.Items {
+		known[entry] = true
+	}
+
+	found := make(map[BaselineEntry]bool)
+	for _, inventoryList := range r.suppressed {
+		for _, violation := range inventoryList.Items {
+			found[baselineEntry(r.cluster, violation)] = true
+		}
+	}
+	r.orphans = filterViolations(r.orphans, func(violation InventoryViolation) bool {
+		entry := baselineEntry(r.cluster, violation)
+		found[entry] = true
+		if known[entry] {
+			r.baselined++
+			return false
+		}
+		return true
+	})
+
+	r.fixed = make([]BaselineEntry, 0)
+	for _, entry := range baseline.Items {
+		if found[entry] || entry.Cluster != r.cluster || (namespace != "" && entry.Namespace != namespace) || !r.lookedFor(entry) {
+			continue
+		}
+		r.fixed = append(r.fixed, entry)
+	}
+	sortBaselineEntries(r.fixed)
+}
+
+// lookedFor tells whether the run would have reported the finding of the entry: its rule is enabled
+// and its checker ran with complete objects in the namespace of the entry.
+func (r *validationResult) lookedFor(entry BaselineEntry) bool {
+	rule, ok := rules[entry.Rule]
+	if !ok || !config.ruleEnabled(entry.Rule) {
+		return false
+	}
+	incomplete, ran := r.checked[rule.Checker]
+	return ran && !incomplete[""] && !incomplete[entry.Namespace]
+}
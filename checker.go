@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Checker inspects a cluster snapshot and reports the violations it finds.
+type Checker interface {
+	// Name is used as the validate subcommand name, e.g. "svc".
+	Name() string
+	Description() string
+	// Kinds lists the resource kinds the checker reads from the snapshot.
+	Kinds() []string
+	// Check returns the violations found. An error means the checker couldn't finish, the run goes
+	// on with the other checkers.
+	Check(ctx context.Context, snapshot *Snapshot) ([]InventoryViolation, error)
+}
+
+type registeredChecker struct {
+	checker Checker
+	aliases []string
+}
+
+var checkers []registeredChecker
+
+// registerChecker adds a checker to the registry. Registered checkers get their own
+// validate subcommand and run as part of the top-level validate command.
+func registerChecker(checker Checker, aliases ...string) {
+	for _, registered := range checkers {
+		if registered.checker.Name() == checker.Name() {
+			panic(fmt.Sprintf("checker %s is already registered", checker.Name()))
+		}
+	}
+	checkers = append(checkers, registeredChecker{checker: checker, aliases: aliases})
+}
+
+func registeredCheckers() []Checker {
+	result := make([]Checker, 0, len(checkers))
+	for _, registered := range checkers {
+		result = append(result, registered.checker)
+	}
+	return result
+}
+
+func findChecker(name string) Checker {
+	for _, registered := range checkers {
+		if registered.checker.Name() == name {
+			return registered.checker
+		}
+	}
+	return nil
+}
+
+// enabledCheckers returns the registered checkers the configuration doesn't disable.
+func enabledCheckers() []Checker {
+	result := make([]Checker, 0, len(checkers))
+	for _, checker := range registeredCheckers() {
+		if config.checkEnabled(checker.Name()) {
+			result = append(result, checker)
+		}
+	}
+	return result
+}
+
+// requiredKinds returns the union of the resource kinds the checkers read. Namespaces are always
+// needed, their annotations can suppress findings.
+func requiredKinds(checks []Checker) []string {
+	kinds := []string{kindNamespace}
+	for _, checker := range checks {
+		for _, kind := range checker.Kinds() {
+			if !contains(kind, kinds) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	return kinds
+}
+
+// appendKinds adds the kinds that aren't in the list yet.
+func appendKinds(kinds []string, more []string) []string {
+	for _, kind := range more {
+		if !contains(kind, kinds) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// validationResult holds the merged findings of a validation run. Findings suppressed by
+// annotations are kept apart so they can still be counted.
+type validationResult struct {
+	// cluster is the kubeconfig context of a multi-cluster run, failed tells it couldn't be validated
+	// and exitCode why.
+	cluster    string
+	failed     bool
+	exitCode   int
+	orphans    map[string]ResourceInventoryList
+	suppressed map[string]ResourceInventoryList
+	timings    []ValidatorTiming
+	// errors lists what couldn't be looked at, the findings are incomplete if there are any. warnings
+	// lists what couldn't be looked at without making them incomplete.
+	errors   []ReportError
+	warnings []ReportError
+	// baselined counts the findings hidden by a baseline, fixed lists the baseline entries that
+	// weren't found anymore.
+	baselined int
+	fixed     []BaselineEntry
+	// routes are the successful routes, only looked for when asked to.
+	routes []Route
+	// checked maps the checkers that ran to the namespaces their findings may be incomplete in, blank
+	// standing for all of them.
+	checked map[string]map[string]bool
+}
+
+// runCheckers runs the checkers against the snapshot and merges their findings into a single inventory.
+// Findings in namespaces where a kind the checker reads couldn't be listed are dropped, the missing
+// objects could make them false positives.
+func runCheckers(ctx context.Context, snapshot *Snapshot, checks []Checker) *validationResult {
+	result := &validationResult{
+		orphans:    make(map[string]ResourceInventoryList),
+		suppressed: make(map[string]ResourceInventoryList),
+		timings:    make([]ValidatorTiming, 0, len(checks)),
+		checked:    make(map[string]map[string]bool),
+	}
+	result.errors, result.warnings = snapshot.reportErrors(checks)
+	now := time.Now()
+	for _, checker := range checks {
+		log.Printf("Running %s validation.\n", checker.Name())
+		start := time.Now()
+		violations, err := checker.Check(ctx, snapshot)
+		result.checked[checker.Name()] = incompleteNamespaces(snapshot, checker)
+		if err != nil {
+			log.Printf("Validation %s failed: %s\n", checker.Name(), err.Error())
+			result.errors = append(result.errors, checkerError(checker, err))
+			result.checked[checker.Name()][""] = true
+		}
+		timing := ValidatorTiming{Validator: checker.Name()}
+		for _, violation := range violations {
+			if incompleteFor(snapshot, checker, violation.Namespace) {
+				continue
+			}
+			if !config.ruleEnabled(violation.Rule) || config.excluded(violation, snapshot.object(violation.Kind, violation.Namespace, violation.Name)) {
+				continue
+			}
+			snapshot.identify(&violation)
+			applyRule(&violation)
+			if description, ok := snapshot.suppression(violation, now); ok {
+				violation.SuppressedBy = description
+				addInventoryViolation(result.suppressed, violation.Namespace, violation.Name, violation)
+				timing.Suppressed++
+				continue
+			}
+			addInventoryViolation(result.orphans, violation.Namespace, violation.Name, violation)
+			timing.Violations++
+		}
+		timing.Duration = time.Since(start).String()
+		result.timings = append(result.timings, timing)
+	}
+	return result
+}
+
+// unknownKinds are the kinds checkers treat as unknown when they couldn't be listed, skipping only
+// the rules that need them instead of dropping all their findings. Ingress classes are cluster-scoped,
+// accounts limited to some namespaces usually can't list them.
+var unknownKinds = []string{kindIngressClass}
+
+// incompleteFor tells whether any kind the checker reads may be missing objects in the namespace.
+func incompleteFor(snapshot *Snapshot, checker Checker, namespace string) bool {
+	for _, kind := range checker.Kinds() {
+		if contains(kind, unknownKinds) {
+			continue
+		}
+		if snapshot.incomplete(kind, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// incompleteNamespaces returns the namespaces any kind the checker reads may be missing objects in,
+// blank standing for all of them.
+func incompleteNamespaces(snapshot *Snapshot, checker Checker) map[string]bool {
+	namespaces := make(map[string]bool)
+	for _, kind := range checker.Kinds() {
+		for namespace := range snapshot.failed[kind] {
+			namespaces[namespace] = true
+		}
+	}
+	return namespaces
+}
+
+// checkerCommands generates a validate subcommand for every registered checker.
+func checkerCommands(flags []cli.Flag, action func(c *cli.Context, checks []Checker) error) []*cli.Command {
+	commands := make([]*cli.Command, 0, len(checkers))
+	for _, registered := range checkers {
+		checker := registered.checker
+		commands = append(commands, &cli.Command{
+			Name:    checker.Name(),
+			Aliases: registered.aliases,
+			Usage:   checker.Description(),
+			Flags:   flags,
+			Action: func(c *cli.Context) error {
+				return action(c, []Checker{checker})
+			},
+		})
+	}
+	return commands
+}
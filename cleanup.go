@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// deletableKinds are the kinds cleanup is allowed to delete. Stuck namespaces are deliberately
+// absent, deleting them again doesn't help.
+var deletableKinds = []string{kindDeployment, kindIngress, kindPod, kindService}
+
+type PlannedDeletion struct {
+	Kind            string `json:",omitempty" yaml:",omitempty"`
+	Namespace       string `json:",omitempty" yaml:",omitempty"`
+	Name            string `json:",omitempty" yaml:",omitempty"`
+	UID             string `json:",omitempty" yaml:",omitempty"`
+	ResourceVersion string `json:",omitempty" yaml:",omitempty"`
+	Reason          string `json:",omitempty" yaml:",omitempty"`
+}
+
+type CleanupPlan struct {
+	Created string            `json:",omitempty" yaml:",omitempty"`
+	Items   []PlannedDeletion `json:",omitempty" yaml:",omitempty"`
+}
+
+// readReport reads a report written by printReport in either the json or the yaml output mode.
+func readReport(path string) (NamespaceList, error) {
+	report := NamespaceList{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	if err := json.Unmarshal(data, &report); err == nil {
+		return report, nil
+	}
+	if err := yaml.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("%s is neither a json nor a yaml report: %s", path, err.Error())
+	}
+	return report, nil
+}
+
+// buildCleanupPlan turns the orphan findings of the report into deletions. Other findings only say
+// an object is misconfigured or degraded, not that it's garbage, so they are never planned; their
+// rules are returned with the number of findings skipped. Findings that can't be deleted safely,
+// because the kind isn't deletable, the object identity wasn't recorded or they belong to a cluster
+// of a multi-cluster report, are skipped too.
+func buildCleanupPlan(report NamespaceList) (CleanupPlan, int, map[string]int) {
+	plan := CleanupPlan{Created: time.Now().UTC().Format(time.RFC3339)}
+	planned := make(map[string]bool)
+	skipped := 0
+	skippedRules := make(map[string]int)
+	for _, namespace := range report.Namespaces {
+		for _, item := range namespace.Items {
+			if findingCategory(item) != categoryOrphan {
+				skipped++
+				skippedRules[item.Rule]++
+				continue
+			}
+			if !contains(item.Kind, deletableKinds) || item.UID == "" || namespace.Cluster != "" {
+				skipped++
+				continue
+			}
+			key := item.Kind + "/" + namespace.Namespace + "/" + item.Name
+			if planned[key] {
+				continue
+			}
+			planned[key] = true
+			plan.Items = append(plan.Items, PlannedDeletion{
+				Kind:            item.Kind,
+				Namespace:       namespace.Namespace,
+				Name:            item.Name,
+				UID:             item.UID,
+				ResourceVersion: item.ResourceVersion,
+				Reason:          item.Reason,
+			})
+		}
+	}
+	sort.Slice(plan.Items, func(i, j int) bool {
+		a, b := plan.Items[i], plan.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return plan, skipped, skippedRules
+}
+
+// ruleLabel names the rule by ID and name for the plan output.
+func ruleLabel(id string) string {
+	if id == "" {
+		return "unclassified"
+	}
+	if rule, ok := rules[id]; ok {
+		return id + " " + rule.Name
+	}
+	return id
+}
+
+// findingCategory returns the category of the rule of the finding, so reports written before a rule
+// changed category are planned by the current one. Findings of unknown rules keep the recorded category.
+func findingCategory(item InventoryViolation) string {
+	if rule, ok := rules[item.Rule]; ok {
+		return rule.Category
+	}
+	return item.Category
+}
+
+func writeCleanupPlan(plan CleanupPlan, path string) error {
+	data, err := yaml.Marshal(&plan)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func readCleanupPlan(path string) (CleanupPlan, error) {
+	plan := CleanupPlan{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return plan, err
+	}
+	err = yaml.Unmarshal(data, &plan)
+	return plan, err
+}
+
+// applyCleanupPlan deletes the planned objects. Objects whose UID or resourceVersion changed since
+// planning are refused, and the same preconditions are enforced by the API server on delete. Every
+// object is backed up to backupDir before it is deleted; an object that can't be backed up is not deleted.
+// resources are the API resources the cluster serves the kinds at.
+func applyCleanupPlan(client dynamic.Interface, resources map[string]schema.GroupVersionResource, plan CleanupPlan, backupDir string, dryRun bool) (deleted int, refused int) {
+	for _, item := range plan.Items {
+		if !contains(item.Kind, deletableKinds) {
+			fmt.Printf("REFUSED %s %s/%s: kind can't be cleaned up\n", item.Kind, item.Namespace, item.Name)
+			refused++
+			continue
+		}
+		resource, ok := resources[item.Kind]
+		if !ok {
+			fmt.Printf("REFUSED %s %s/%s: the cluster doesn't serve %ss\n", item.Kind, item.Namespace, item.Name, item.Kind)
+			refused++
+			continue
+		}
+		resourceClient := client.Resource(resource).Namespace(item.Namespace)
+
+		current, err := resourceClient.Get(item.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			fmt.Printf("SKIPPED %s %s/%s: already gone\n", item.Kind, item.Namespace, item.Name)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("FAILED %s %s/%s: %s\n", item.Kind, item.Namespace, item.Name, err.Error())
+			refused++
+			continue
+		}
+		if string(current.GetUID()) != item.UID {
+			fmt.Printf("REFUSED %s %s/%s: object was recreated since planning\n", item.Kind, item.Namespace, item.Name)
+			refused++
+			continue
+		}
+		if current.GetResourceVersion() != item.ResourceVersion {
+			fmt.Printf("REFUSED %s %s/%s: object was modified since planning\n", item.Kind, item.Namespace, item.Name)
+			refused++
+			continue
+		}
+
+		file := ""
+		if !dryRun {
+			file, err = writeBackup(backupDir, item, current)
+			if err != nil {
+				fmt.Printf("REFUSED %s %s/%s: unable to back up: %s\n", item.Kind, item.Namespace, item.Name, err.Error())
+				refused++
+				continue
+			}
+		}
+
+		uid := types.UID(item.UID)
+		resourceVersion := item.ResourceVersion
+		options := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion}}
+		if dryRun {
+			options.DryRun = []string{metav1.DryRunAll}
+		}
+		if err := resourceClient.Delete(item.Name, options); err != nil {
+			fmt.Printf("FAILED %s %s/%s: %s\n", item.Kind, item.Namespace, item.Name, err.Error())
+			refused++
+			continue
+		}
+		if !dryRun {
+			err = recordBackup(backupDir, BackupEntry{Kind: item.Kind, Namespace: item.Namespace, Name: item.Name, UID: item.UID, File: file, Reason: item.Reason})
+			if err != nil {
+				fmt.Printf("WARNING %s %s/%s: deleted, but not recorded in the backup index: %s\n", item.Kind, item.Namespace, item.Name, err.Error())
+			}
+		}
+		fmt.Printf("DELETED %s %s/%s (%s)\n", item.Kind, item.Namespace, item.Name, item.Reason)
+		deleted++
+	}
+	return deleted, refused
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBuildCleanupPlanOnlyPlansOrphans(t *testing.T) {
+	report := NamespaceList{Namespaces: []Namespace{{
+		Namespace: "team-a",
+		Items: []InventoryViolation{
+			{Rule: "ING006", Category: categoryOrphan, Kind: kindIngress, Name: "dangling", UID: "1"},
+			// ING001 was an orphan rule once, the current category of the rule counts.
+			{Rule: "ING001", Category: categoryOrphan, Kind: kindIngress, Name: "half-routed", UID: "11"},
+			{Rule: "SVC005", Category: categoryOrphan, Kind: kindService, Name: "idle", UID: "2"},
+			{Rule: "DEP001", Category: categoryOrphan, Kind: kindDeployment, Name: "scaled", UID: "3"},
+			{Rule: "DEP003", Category: categoryDegraded, Kind: kindDeployment, Name: "busy", UID: "4"},
+			{Rule: "ING005", Category: categoryMisconfiguration, Kind: kindIngress, Name: "annotated", UID: "5"},
+			{Rule: "SVC006", Category: categoryMisconfiguration, Kind: kindService, Name: "ports", UID: "6"},
+			// Older reports don't record the category, it comes from the rule.
+			{Rule: "SVC008", Kind: kindService, Name: "unready", UID: "7"},
+			{Rule: "SVC005", Kind: kindService, Name: "legacy", UID: "8"},
+			{Rule: "NS001", Category: categoryDegraded, Kind: kindNamespace, Name: "team-a", UID: "9"},
+			{Kind: kindService, Name: "unknown", UID: "10"},
+		},
+	}}}
+
+	plan, skipped, skippedRules := buildCleanupPlan(report)
+
+	planned := make([]string, 0, len(plan.Items))
+	for _, item := range plan.Items {
+		planned = append(planned, item.Kind+"/"+item.Name)
+	}
+	want := []string{"deployment/scaled", "ingress/dangling", "service/idle", "service/legacy"}
+	if len(planned) != len(want) {
+		t.Fatalf("planned %v, want %v", planned, want)
+	}
+	for i := range want {
+		if planned[i] != want[i] {
+			t.Fatalf("planned %v, want %v", planned, want)
+		}
+	}
+	if skipped != 7 {
+		t.Errorf("skipped %d findings, want 7", skipped)
+	}
+	for _, rule := range []string{"DEP003", "ING001", "ING005", "SVC006", "SVC008", "NS001", ""} {
+		if skippedRules[rule] != 1 {
+			t.Errorf("skipped %d %q findings, want 1", skippedRules[rule], rule)
+		}
+	}
+}
+
+const mixedIngressManifests = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: team-a
+  uid: svc-web
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: team-a
+  uid: ing-web
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: web
+            port:
+              number: 80
+      - path: /api
+        backend:
+          service:
+            name: gone
+            port:
+              number: 80
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: dead
+  namespace: team-a
+  uid: ing-dead
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: gone
+            port:
+              number: 80
+`
+
+func TestBuildCleanupPlanKeepsPartlyRoutedIngress(t *testing.T) {
+	objects, err := readManifests(strings.NewReader(mixedIngressManifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := newSnapshot("")
+	for _, obj := range objects {
+		snapshot.addManifest(obj)
+	}
+	violations, err := ingressChecker{}.Check(context.Background(), snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespace := Namespace{Namespace: "team-a"}
+	for _, violation := range violations {
+		snapshot.identify(&violation)
+		applyRule(&violation)
+		namespace.Items = append(namespace.Items, violation)
+	}
+
+	plan, _, skippedRules := buildCleanupPlan(NamespaceList{Namespaces: []Namespace{namespace}})
+
+	if len(plan.Items) != 1 || plan.Items[0].Name != "dead" {
+		t.Fatalf("planned %v, want only ingress dead", plan.Items)
+	}
+	if skippedRules["ING001"] != 2 {
+		t.Errorf("skipped %d ING001 findings, want 2", skippedRules["ING001"])
+	}
+}
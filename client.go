@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// connectionOptions select the cluster, the credentials and the client-side limits of the API clients.
+type connectionOptions struct {
+	// kubeconfig is the kubeconfig file; blank uses $KUBECONFIG or ~/.kube/config like kubectl.
+	kubeconfig string
+	context    string
+	cluster    string
+	// as and asGroups impersonate a user and its groups.
+	as             string
+	asGroups       []string
+	requestTimeout string
+	qps            float64
+	burst          int
+	// caFile replaces the certificate authority of the kubeconfig or the service account,
+	// insecureSkipTLSVerify turns certificate verification off altogether.
+	caFile                string
+	insecureSkipTLSVerify bool
+}
+
+// clientFactory builds the API clients of every command from the same connection options. The
+// configuration is resolved once and shared by all clients.
+type clientFactory struct {
+	options connectionOptions
+	config  *rest.Config
+}
+
+func newClientFactory(options connectionOptions) *clientFactory {
+	return &clientFactory{options: options}
+}
+
+// restConfig resolves the client configuration from the kubeconfig. Without a kubeconfig, and when
+// no context or cluster was asked for, it falls back to the in-cluster service account.
+func (f *clientFactory) restConfig() (*rest.Config, error) {
+	if f.config != nil {
+		return f.config, nil
+	}
+	timeout, err := time.ParseDuration(f.options.requestTimeout)
+	if f.options.requestTimeout != "" && err != nil {
+		return nil, fmt.Errorf("invalid request timeout %s: %s", f.options.requestTimeout, err.Error())
+	}
+	if f.options.caFile != "" && f.options.insecureSkipTLSVerify {
+		return nil, fmt.Errorf("a CA file can't be used when TLS verification is skipped")
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = f.options.kubeconfig
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var config *rest.Config
+	if clientcmdapi.IsConfigEmpty(raw) && f.options.context == "" && f.options.cluster == "" {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("no kubeconfig found and not running in a cluster: %s", err.Error())
+		}
+		config.Impersonate = rest.ImpersonationConfig{UserName: f.options.as, Groups: f.options.asGroups}
+		if f.options.caFile != "" {
+			config.TLSClientConfig.CAFile = f.options.caFile
+			config.TLSClientConfig.CAData = nil
+		}
+		if f.options.insecureSkipTLSVerify {
+			config.TLSClientConfig.Insecure = true
+			config.TLSClientConfig.CAFile = ""
+			config.TLSClientConfig.CAData = nil
+		}
+		log.Printf("Configured to run in in-cluster mode.\n")
+	} else {
+		overrides := &clientcmd.ConfigOverrides{
+			CurrentContext: f.options.context,
+			Context:        clientcmdapi.Context{Cluster: f.options.cluster},
+			AuthInfo:       clientcmdapi.AuthInfo{Impersonate: f.options.as, ImpersonateGroups: f.options.asGroups},
+			// The CA of the kubeconfig is used unless one of these overrides it.
+			ClusterInfo: clientcmdapi.Cluster{CertificateAuthority: f.options.caFile, InsecureSkipTLSVerify: f.options.insecureSkipTLSVerify},
+		}
+		clientConfig := clientcmd.NewDefaultClientConfig(*raw, overrides)
+		config, err = clientConfig.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		context := f.options.context
+		if context == "" {
+			context = raw.CurrentContext
+		}
+		log.Printf("Configured to run in out-of cluster mode, using context %s.\n", context)
+	}
+
+	if config.TLSClientConfig.Insecure {
+		log.Printf("WARNING: TLS certificate verification is turned off.\n")
+	}
+	config.Timeout = timeout
+	if f.options.qps > 0 {
+		config.QPS = float32(f.options.qps)
+	}
+	if f.options.burst > 0 {
+		config.Burst = f.options.burst
+	}
+	f.config = config
+	return config, nil
+}
+
+func (f *clientFactory) kubernetesClient() (kubernetes.Interface, error) {
+	config, err := f.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func (f *clientFactory) dynamicClient() (dynamic.Interface, error) {
+	config, err := f.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+// apiClients builds the clients a snapshot is listed with and discovers the API resources the
+// server serves.
+func (f *clientFactory) apiClients() (*apiClients, error) {
+	clientset, err := f.kubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := f.dynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	resources, err := discoverResources(clientset.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	return &apiClients{clientset: clientset, dynamic: dynamicClient, resources: resources}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterContexts returns the kubeconfig contexts to validate: all of them, or the listed ones
+// after checking they exist. Listed names may be comma separated.
+func clusterContexts(options connectionOptions, all bool, names []string) ([]string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = options.kubeconfig
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	contexts := make([]string, 0, len(raw.Contexts))
+	if all {
+		for name := range raw.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+		if len(contexts) == 0 {
+			return nil, fmt.Errorf("the kubeconfig has no contexts")
+		}
+		return contexts, nil
+	}
+	for _, name := range strings.Split(strings.Join(names, ","), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := raw.Contexts[name]; !ok {
+			return nil, fmt.Errorf("context %q does not exist", name)
+		}
+		if !contains(name, contexts) {
+			contexts = append(contexts, name)
+		}
+	}
+	return contexts, nil
+}
+
+// validateClusters validates every context concurrently, each with its own clients and snapshot.
+// A cluster that can't be reached is marked as failed in its result and doesn't hold up the others.
+func validateClusters(options connectionOptions, contexts []string, namespace string, checks []Checker, routes bool) []*validationResult {
+	results := make([]*validationResult, len(contexts))
+	var wg sync.WaitGroup
+	for i, name := range contexts {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			clusterOptions := options
+			clusterOptions.context = name
+			result, err := validate(newClientFactory(clusterOptions), "", "", namespace, checks, routes)
+			if err != nil {
+				log.Printf("Unable to validate cluster %s: %s\n", name, err.Error())
+				result = &validationResult{failed: true, exitCode: exitCode(err, exitConnection), errors: []ReportError{{Message: err.Error()}}}
+			}
+			result.cluster = name
+			results[i] = result
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type CheckConfig struct {
+	Enabled *bool `yaml:"enabled,omitempty"`
+}
+
+type RuleConfig struct {
+	Enabled  *bool  `yaml:"enabled,omitempty"`
+	Severity string `yaml:"severity,omitempty"`
+}
+
+type Thresholds struct {
+	// MinimumAge hides violations on objects younger than this, they may still be settling.
+	MinimumAge string `yaml:"minimumAge,omitempty"`
+	// LoadBalancerPending is how long a LoadBalancer service may wait for its address.
+	LoadBalancerPending string `yaml:"loadBalancerPending,omitempty"`
+	// MinReplicas and MinReadyReplicas are the replica counts below which deployments are reported.
+	MinReplicas      int32 `yaml:"minReplicas"`
+	MinReadyReplicas int32 `yaml:"minReadyReplicas"`
+
+	minimumAge          time.Duration
+	loadBalancerPending time.Duration
+}
+
+type Exclusions struct {
+	// Namespaces are globs matched against the namespace of the object.
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// Names are globs matched against the object name, or against namespace/name if they contain a slash.
+	Names []string `yaml:"names,omitempty"`
+	// Labels are label selectors, objects matching any of them are excluded.
+	Labels []string `yaml:"labels,omitempty"`
+
+	selectors []labels.Selector
+}
+
+// Config controls which checks run, their thresholds and what they report on.
+type Config struct {
+	Checks     map[string]CheckConfig `yaml:"checks,omitempty"`
+	Rules      map[string]RuleConfig  `yaml:"rules,omitempty"`
+	Thresholds Thresholds             `yaml:"thresholds,omitempty"`
+	Exclude    Exclusions             `yaml:"exclude,omitempty"`
+}
+
+// config is the configuration of the current run.
+var config = defaultConfig()
+
+func defaultConfig() *Config {
+	c := &Config{
+		Thresholds: Thresholds{MinReplicas: 1, MinReadyReplicas: 1},
+		Exclude:    Exclusions{Names: []string{"default/kubernetes"}},
+	}
+	if err := c.validate(); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// loadConfig reads the configuration file on top of the defaults. Unknown fields are rejected.
+func loadConfig(file string) (*Config, error) {
+	c := defaultConfig()
+	if file == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return c, nil
+}
+
+// validate checks the configuration and prepares the parsed thresholds and selectors. All problems
+// are reported at once, each prefixed with the path of the offending field.
+func (c *Config) validate() error {
+	problems := make([]string, 0)
+	for name := range c.Checks {
+		if findChecker(name) == nil {
+			problems = append(problems, fmt.Sprintf("checks.%s: unknown check", name))
+		}
+	}
+	for id, rule := range c.Rules {
+		if _, ok := rules[id]; !ok {
+			problems = append(problems, fmt.Sprintf("rules.%s: unknown rule", id))
+		}
+		if rule.Severity != "" && severityRank(rule.Severity) < 0 {
+			problems = append(problems, fmt.Sprintf("rules.%s.severity: unknown severity %s, expected one of %v", id, rule.Severity, severities))
+		}
+	}
+
+	var err error
+	if c.Thresholds.minimumAge, err = parseThreshold(c.Thresholds.MinimumAge); err != nil {
+		problems = append(problems, "thresholds.minimumAge: "+err.Error())
+	}
+	if c.Thresholds.loadBalancerPending, err = parseThreshold(c.Thresholds.LoadBalancerPending); err != nil {
+		problems = append(problems, "thresholds.loadBalancerPending: "+err.Error())
+	}
+	if c.Thresholds.MinReplicas < 0 {
+		problems = append(problems, "thresholds.minReplicas: must not be negative")
+	}
+	if c.Thresholds.MinReadyReplicas < 0 {
+		problems = append(problems, "thresholds.minReadyReplicas: must not be negative")
+	}
+
+	for i, pattern := range c.Exclude.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("exclude.namespaces[%d]: invalid glob %s", i, pattern))
+		}
+	}
+	for i, pattern := range c.Exclude.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("exclude.names[%d]: invalid glob %s", i, pattern))
+		}
+	}
+	c.Exclude.selectors = make([]labels.Selector, 0, len(c.Exclude.Labels))
+	for i, selector := range c.Exclude.Labels {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("exclude.labels[%d]: %s", i, err.Error()))
+			continue
+		}
+		c.Exclude.selectors = append(c.Exclude.selectors, parsed)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func parseThreshold(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return duration, nil
+}
+
+func (c *Config) checkEnabled(name string) bool {
+	check, ok := c.Checks[name]
+	return !ok || check.Enabled == nil || *check.Enabled
+}
+
+func (c *Config) ruleEnabled(id string) bool {
+	rule, ok := c.Rules[id]
+	return !ok || rule.Enabled == nil || *rule.Enabled
+}
+
+// ruleSeverity returns the configured severity of the rule, or blank to keep the default.
+func (c *Config) ruleSeverity(id string) string {
+	return c.Rules[id].Severity
+}
+
+// excluded tells whether the object the violation was found on is excluded from the report.
+func (c *Config) excluded(violation InventoryViolation, obj metav1.Object) bool {
+	for _, pattern := range c.Exclude.Namespaces {
+		if matched, _ := path.Match(pattern, violation.Namespace); matched {
+			return true
+		}
+	}
+	for _, pattern := range c.Exclude.Names {
+		name := violation.Name
+		if strings.Contains(pattern, "/") {
+			name = violation.Namespace + "/" + violation.Name
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	if obj == nil {
+		return false
+	}
+	if c.Thresholds.minimumAge > 0 && time.Since(obj.GetCreationTimestamp().Time) < c.Thresholds.minimumAge {
+		return true
+	}
+	for _, selector := range c.Exclude.selectors {
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cheggaaa/pb"
+	v1apps "k8s.io/api/apps/v1"
+)
+
+type deploymentChecker struct{}
+
+func init() {
+	registerChecker(deploymentChecker{}, "deployment", "deployments")
+}
+
+func (deploymentChecker) Name() string        { return "dep" }
+func (deploymentChecker) Description() string { return "validate deployment(s)" }
+func (deploymentChecker) Kinds() []string     { return []string{kindDeployment} }
+
+func (deploymentChecker) Check(ctx context.Context, snapshot *Snapshot) ([]InventoryViolation, error) {
+	violations := make([]InventoryViolation, 0)
+	graph, err := snapshot.Graph()
+	if err != nil {
+		return nil, err
+	}
+	nodes := graph.Nodes(kindDeployment)
+
+	bar := pb.StartNew(len(nodes))
+	for _, node := range nodes {
+		bar.Increment()
+		// Owners of pods that aren't in the snapshot have no object.
+		if node.object == nil {
+			continue
+		}
+		deployment := node.object.(*v1apps.Deployment)
+		hasStatus := deploymentHasStatus(deployment)
+
+		replicas := deployment.Status.Replicas
+		if !hasStatus {
+			replicas = desiredReplicas(deployment)
+		}
+		if replicas < config.Thresholds.MinReplicas {
+			violations = append(violations, InventoryViolation{Rule: "DEP001", Reason: fmt.Sprintf("deployment scaled down to %d replicas", replicas), Kind: kindDeployment, Name: deployment.Name, Namespace: deployment.Namespace})
+			continue
+		}
+
+		if len(deployment.Labels) == 0 {
+			violations = append(violations, InventoryViolation{Rule: "DEP002", Reason: "no labels on deployment", Kind: kindDeployment, Name: deployment.Name, Namespace: deployment.Namespace})
+			continue
+		}
+
+		// The remaining rules read the status, which deployments read from manifests don't have.
+		if !hasStatus {
+			continue
+		}
+
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == v1apps.DeploymentAvailable && condition.Status == "False" && condition.Reason == "MinimumReplicasUnavailable" {
+				violations = append(violations, InventoryViolation{Rule: "DEP003", Reason: "minimum replicas unavailable, could be temporary", Kind: kindDeployment, Name: deployment.Name, Namespace: deployment.Namespace})
+				continue
+			}
+
+			if condition.Type == v1apps.DeploymentProgressing && condition.Status == "False" && condition.Reason == "ProgressDeadlineExceeded" {
+				violations = append(violations, InventoryViolation{Rule: "DEP004", Reason: condition.Message, Kind: kindDeployment, Name: deployment.Name, Namespace: deployment.Namespace})
+				continue
+			}
+		}
+		if deployment.Status.ReadyReplicas < config.Thresholds.MinReadyReplicas {
+			reason := "no replicas are ready"
+			if deployment.Status.ReadyReplicas > 0 {
+				reason = fmt.Sprintf("only %d replicas are ready", deployment.Status.ReadyReplicas)
+			}
+			violations = append(violations, InventoryViolation{Rule: "DEP005", Reason: reason, Kind: kindDeployment, Name: deployment.Name, Namespace: deployment.Namespace})
+			continue
+		}
+	}
+	bar.Finish()
+	return violations, nil
+}
+
+// deploymentHasStatus tells whether the deployment was observed by its controller. Deployments read
+// from manifests have no status.
+func deploymentHasStatus(deployment *v1apps.Deployment) bool {
+	return deployment.Status.ObservedGeneration != 0 || len(deployment.Status.Conditions) > 0
+}
+
+// desiredReplicas returns the replicas the spec asks for, one if unset.
+func desiredReplicas(deployment *v1apps.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
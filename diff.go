@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type ChangedViolation struct {
+	Kind      string `json:",omitempty" yaml:",omitempty"`
+	Name      string `json:",omitempty" yaml:",omitempty"`
+	Rule      string `json:",omitempty" yaml:",omitempty"`
+	OldReason string `json:",omitempty" yaml:",omitempty"`
+	NewReason string `json:",omitempty" yaml:",omitempty"`
+}
+
+type NamespaceDiff struct {
+	Cluster     string               `json:",omitempty" yaml:",omitempty"`
+	Namespace   string               `json:",omitempty" yaml:",omitempty"`
+	Appeared    []InventoryViolation `json:",omitempty" yaml:",omitempty"`
+	Disappeared []InventoryViolation `json:",omitempty" yaml:",omitempty"`
+	Changed     []ChangedViolation   `json:",omitempty" yaml:",omitempty"`
+}
+
+type ReportDiff struct {
+	Namespaces []NamespaceDiff `json:",omitempty" yaml:",omitempty"`
+}
+
+type diffKey struct {
+	cluster   string
+	namespace string
+	kind      string
+	name      string
+	rule      string
+}
+
+func indexReport(report NamespaceList) map[diffKey]InventoryViolation {
+	index := make(map[diffKey]InventoryViolation)
+	for _, namespace := range report.Namespaces {
+		for _, item := range namespace.Items {
+			index[diffKey{cluster: namespace.Cluster, namespace: namespace.Namespace, kind: item.Kind, name: item.Name, rule: item.Rule}] = item
+		}
+	}
+	return index
+}
+
+// diffReports compares two reports. Violations are matched by cluster, namespace, kind, name and rule, so a
+// violation whose reason changed is reported as changed rather than as one appearing and one disappearing.
+func diffReports(old NamespaceList, new NamespaceList) ReportDiff {
+	oldIndex := indexReport(old)
+	newIndex := indexReport(new)
+	namespaces := make(map[string]*NamespaceDiff)
+	namespaceDiff := func(key diffKey) *NamespaceDiff {
+		label := namespaceLabel(key.cluster, key.namespace)
+		if _, ok := namespaces[label]; !ok {
+			namespaces[label] = &NamespaceDiff{Cluster: key.cluster, Namespace: key.namespace}
+		}
+		return namespaces[label]
+	}
+
+	for key, item := range newIndex {
+		oldItem, ok := oldIndex[key]
+		if !ok {
+			diff := namespaceDiff(key)
+			diff.Appeared = append(diff.Appeared, item)
+			continue
+		}
+		if oldItem.Reason != item.Reason {
+			diff := namespaceDiff(key)
+			diff.Changed = append(diff.Changed, ChangedViolation{Kind: item.Kind, Name: item.Name, Rule: item.Rule, OldReason: oldItem.Reason, NewReason: item.Reason})
+		}
+	}
+	for key, item := range oldIndex {
+		if _, ok := newIndex[key]; !ok {
+			diff := namespaceDiff(key)
+			diff.Disappeared = append(diff.Disappeared, item)
+		}
+	}
+
+	result := ReportDiff{}
+	for _, diff := range namespaces {
+		sorted := sortedNamespaces([]Namespace{{Items: diff.Appeared}, {Items: diff.Disappeared}})
+		diff.Appeared, diff.Disappeared = sorted[0].Items, sorted[1].Items
+		sort.Slice(diff.Changed, func(i, j int) bool {
+			if diff.Changed[i].Kind != diff.Changed[j].Kind {
+				return diff.Changed[i].Kind < diff.Changed[j].Kind
+			}
+			if diff.Changed[i].Name != diff.Changed[j].Name {
+				return diff.Changed[i].Name < diff.Changed[j].Name
+			}
+			return diff.Changed[i].Rule < diff.Changed[j].Rule
+		})
+		result.Namespaces = append(result.Namespaces, *diff)
+	}
+	sort.Slice(result.Namespaces, func(i, j int) bool {
+		if result.Namespaces[i].Cluster != result.Namespaces[j].Cluster {
+			return result.Namespaces[i].Cluster < result.Namespaces[j].Cluster
+		}
+		return result.Namespaces[i].Namespace < result.Namespaces[j].Namespace
+	})
+	return result
+}
+
+func printTextDiff(w io.Writer, diff ReportDiff, color bool) {
+	if len(diff.Namespaces) == 0 {
+		fmt.Fprintf(w, "No changes.\n")
+		return
+	}
+	appeared, disappeared, changed := 0, 0, 0
+	for _, namespace := range diff.Namespaces {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Namespace: "+namespaceLabel(namespace.Cluster, namespace.Namespace), colorBold, color))
+		for _, item := range namespace.Appeared {
+			fmt.Fprintf(w, "%s\n", colorize(fmt.Sprintf("+ %s %s %s: %s", item.Kind, item.Name, item.Rule, strings.Join(strings.Fields(item.Reason), " ")), colorRed, color))
+		}
+		for _, item := range namespace.Disappeared {
+			fmt.Fprintf(w, "%s\n", colorize(fmt.Sprintf("- %s %s %s: %s", item.Kind, item.Name, item.Rule, strings.Join(strings.Fields(item.Reason), " ")), colorGreen, color))
+		}
+		for _, item := range namespace.Changed {
+			fmt.Fprintf(w, "%s\n", colorize(fmt.Sprintf("~ %s %s %s: %s -> %s", item.Kind, item.Name, item.Rule, item.OldReason, item.NewReason), colorYellow, color))
+		}
+		appeared += len(namespace.Appeared)
+		disappeared += len(namespace.Disappeared)
+		changed += len(namespace.Changed)
+	}
+	fmt.Fprintf(w, "\n%d appeared, %d disappeared, %d changed\n", appeared, disappeared, changed)
+}
+
+func printDiff(diff ReportDiff, outputMode string) error {
+	switch defaultOutputMode(outputMode) {
+	case "text":
+		printTextDiff(os.Stdout, diff, stdoutIsTerminal())
+	case "yaml":
+		pretty, err := yaml.Marshal(&diff)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(pretty))
+	case "json":
+		pretty, err := json.MarshalIndent(diff, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(pretty))
+	default:
+		return fmt.Errorf("unsupported output format %s for diff", outputMode)
+	}
+	return nil
+}
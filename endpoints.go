@@ -0,0 +1,66 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// endpointSliceServiceLabel links an EndpointSlice to its service.
+const endpointSliceServiceLabel = "kubernetes.io/service-name"
+
+// EndpointSlice is the version independent view of an EndpointSlice, the discovery.k8s.io/v1beta1
+// and v1 APIs both decode into it.
+type EndpointSlice struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Endpoints         []Endpoint `json:"endpoints"`
+}
+
+type Endpoint struct {
+	Addresses  []string            `json:"addresses"`
+	Conditions EndpointConditions  `json:"conditions,omitempty"`
+	TargetRef  *v1.ObjectReference `json:"targetRef,omitempty"`
+}
+
+type EndpointConditions struct {
+	// Ready is unknown when nil, which consumers treat as ready.
+	Ready *bool `json:"ready,omitempty"`
+}
+
+// serviceAddresses counts the ready and not ready addresses of the service. They are read from its
+// EndpointSlices when the cluster serves them (or, offline, when there are any), and from its
+// Endpoints otherwise, since the Endpoints of large services are truncated.
+func serviceAddresses(snapshot *Snapshot, service *v1.Service) (ready int, notReady int, err error) {
+	if snapshot.EndpointSlicesKnown() {
+		slices, err := snapshot.EndpointSlices(service.Namespace, service.Name)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, slice := range slices {
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					ready += len(endpoint.Addresses)
+				} else {
+					notReady += len(endpoint.Addresses)
+				}
+			}
+		}
+		return ready, notReady, nil
+	}
+
+	endpoints, ok := snapshot.Endpoints(service.Namespace, service.Name)
+	if !ok {
+		return 0, 0, nil
+	}
+	ready, notReady = endpointsAddresses(endpoints)
+	return ready, notReady, nil
+}
+
+// endpointsAddresses counts the ready and not ready addresses of an Endpoints object.
+func endpointsAddresses(endpoints *v1.Endpoints) (ready int, notReady int) {
+	for _, subset := range endpoints.Subsets {
+		ready += len(subset.Addresses)
+		notReady += len(subset.NotReadyAddresses)
+	}
+	return ready, notReady
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes, so pipelines can tell a clean cluster from findings and from failures. Usage and
+// other unexpected errors exit with 1.
+const (
+	exitClean = 0
+	// exitFindings is the default when findings at or above --fail-on exist, see --findings-exit-code.
+	exitFindings = 2
+	// exitConnection means the API server could not be reached.
+	exitConnection = 3
+	// exitAuth means the credentials were rejected or lack the permissions needed.
+	exitAuth = 4
+	// exitPartial means some of the work could not be done and the results are incomplete.
+	exitPartial = 5
+)
+
+// failOnNone disables failing on findings.
+const failOnNone = "none"
+
+// connectionExitCode tells authentication and authorization failures apart from other failures
+// to talk to the API server.
+func connectionExitCode(err error) int {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if apierrors.IsUnauthorized(e) || apierrors.IsForbidden(e) {
+			return exitAuth
+		}
+	}
+	return exitConnection
+}
+
+// connectionError wraps a failure to talk to the API server so the command exits with the matching code.
+func connectionError(message string, err error) error {
+	return cli.Exit(fmt.Sprintf("%s: %s", message, err.Error()), connectionExitCode(err))
+}
+
+// exitCode returns the code the error exits with, or the fallback for errors that don't carry one.
+func exitCode(err error, fallback int) int {
+	var exitCoder cli.ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+	return fallback
+}
+
+// failedClustersExitCode returns the exit code of a run in which no cluster could be validated:
+// exitAuth when every cluster rejected the credentials, exitConnection otherwise. It returns
+// exitClean when some cluster was validated.
+func failedClustersExitCode(results []*validationResult) int {
+	code := exitAuth
+	for _, result := range results {
+		if !result.failed {
+			return exitClean
+		}
+		if result.exitCode != exitAuth {
+			code = exitConnection
+		}
+	}
+	return code
+}
+
+// failingFindings counts the findings at or above the fail-on severity. A blank severity counts
+// every finding, failOnNone none of them.
+func failingFindings(orphans map[string]ResourceInventoryList, failOn string) int {
+	if failOn == failOnNone {
+		return 0
+	}
+	return countViolations(filterViolations(orphans, atLeastSeverity(failOn)))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// graphOutputModes are the formats the graph command exports to.
+var graphOutputModes = []string{"dot", "mermaid", "json"}
+
+// GraphExport is the json form of the dependency graph. Nodes are referenced by their ID, kind/namespace/name.
+type GraphExport struct {
+	Nodes []GraphNodeExport `json:",omitempty" yaml:",omitempty"`
+	Edges []GraphEdgeExport `json:",omitempty" yaml:",omitempty"`
+}
+
+type GraphNodeExport struct {
+	ID           string `json:",omitempty" yaml:",omitempty"`
+	Kind         string `json:",omitempty" yaml:",omitempty"`
+	Namespace    string `json:",omitempty" yaml:",omitempty"`
+	Name         string `json:",omitempty" yaml:",omitempty"`
+	Missing      bool   `json:",omitempty" yaml:",omitempty"`
+	Orphan       bool   `json:",omitempty" yaml:",omitempty"`
+	Ready        bool   `json:",omitempty" yaml:",omitempty"`
+	ExternalName string `json:",omitempty" yaml:",omitempty"`
+}
+
+type GraphEdgeExport struct {
+	From     string `json:",omitempty" yaml:",omitempty"`
+	To       string `json:",omitempty" yaml:",omitempty"`
+	Relation string `json:",omitempty" yaml:",omitempty"`
+	Host     string `json:",omitempty" yaml:",omitempty"`
+	Path     string `json:",omitempty" yaml:",omitempty"`
+	Port     string `json:",omitempty" yaml:",omitempty"`
+	Broken   bool   `json:",omitempty" yaml:",omitempty"`
+	Reason   string `json:",omitempty" yaml:",omitempty"`
+}
+
+// Orphan tells whether nothing can be reached through the node: it is missing, an ingress whose
+// routes are all broken, a service with a selector that selects no pods, or a deployment, daemon
+// set or stateful set without pods.
+func (g *Graph) Orphan(node *GraphNode) bool {
+	if node.Missing {
+		return true
+	}
+	switch node.Kind {
+	case kindIngress:
+		for _, edge := range g.Out(node, relationRoutes) {
+			if !edge.Broken {
+				return false
+			}
+		}
+		return true
+	case kindService:
+		service, ok := node.object.(*v1.Service)
+		if !ok || len(service.Spec.Selector) == 0 || service.Spec.Type == v1.ServiceTypeExternalName {
+			return false
+		}
+		for _, edge := range g.Out(node, relationSelects) {
+			if !edge.Broken {
+				return false
+			}
+		}
+		return true
+	case kindDeployment, kindDaemonSet, kindStatefulSet:
+		if node.object == nil {
+			return false
+		}
+		return !g.ownsPod(node, map[*GraphNode]bool{node: true})
+	}
+	return false
+}
+
+// ownsPod tells whether a pod is owned by the node, directly or through the replica sets it owns.
+func (g *Graph) ownsPod(node *GraphNode, seen map[*GraphNode]bool) bool {
+	for _, edge := range g.In(node, relationOwnedBy) {
+		owned := edge.From
+		if owned.Kind == kindPod {
+			return true
+		}
+		if seen[owned] {
+			continue
+		}
+		seen[owned] = true
+		if g.ownsPod(owned, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Edges returns every edge, in the order of the nodes they leave.
+func (g *Graph) Edges() []*GraphEdge {
+	edges := make([]*GraphEdge, 0)
+	for _, node := range g.Nodes("") {
+		edges = append(edges, g.out[node]...)
+	}
+	return edges
+}
+
+func graphNodeID(node *GraphNode) string {
+	return nodeKey(node.Kind, node.Namespace, node.Name)
+}
+
+// edgeLabel describes the ingress rule of a routes edge, or why an edge is broken.
+func edgeLabel(edge *GraphEdge) string {
+	label := edge.Host + edge.Path
+	if edge.Port != "" {
+		label += ":" + edge.Port
+	}
+	if edge.Broken {
+		label = strings.TrimSpace(label + " " + edge.Reason)
+	}
+	return label
+}
+
+// nodeLabel names the node by kind and name, with the external name of ExternalName services.
+func nodeLabel(node *GraphNode) string {
+	label := node.Kind + "/" + node.Name
+	if node.ExternalName != "" {
+		label += " -> " + node.ExternalName
+	}
+	if node.Missing {
+		label += " (missing)"
+	}
+	return label
+}
+
+// writeGraph exports the graph in one of the graphOutputModes.
+func writeGraph(w io.Writer, graph *Graph, outputMode string) error {
+	switch outputMode {
+	case "dot":
+		writeDot(w, graph)
+	case "mermaid":
+		writeMermaid(w, graph)
+	case "json":
+		return writeGraphJSON(w, graph)
+	default:
+		return fmt.Errorf("unknown graph output format %s, use one of %s", outputMode, strings.Join(graphOutputModes, ", "))
+	}
+	return nil
+}
+
+// writeDot writes a Graphviz digraph with a cluster per namespace. Broken edges and orphan nodes
+// are red and dashed.
+func writeDot(w io.Writer, graph *Graph) {
+	fmt.Fprintf(w, "digraph \"kube-cleanup\" {\n")
+	fmt.Fprintf(w, "  rankdir=LR;\n")
+	fmt.Fprintf(w, "  node [shape=box, fontname=\"Helvetica\"];\n")
+	fmt.Fprintf(w, "  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	namespace := ""
+	open := false
+	for _, node := range graph.Nodes("") {
+		if !open || node.Namespace != namespace {
+			if open {
+				fmt.Fprintf(w, "  }\n")
+			}
+			namespace, open = node.Namespace, true
+			fmt.Fprintf(w, "  subgraph %q {\n    label=%q;\n", "cluster_"+namespace, namespace)
+		}
+		attributes := fmt.Sprintf("label=%q", nodeLabel(node))
+		if graph.Orphan(node) {
+			attributes += ", color=red, fontcolor=red, style=dashed"
+		}
+		fmt.Fprintf(w, "    %q [%s];\n", graphNodeID(node), attributes)
+	}
+	if open {
+		fmt.Fprintf(w, "  }\n")
+	}
+	for _, edge := range graph.Edges() {
+		attributes := fmt.Sprintf("label=%q", edgeLabel(edge))
+		if edge.Broken {
+			attributes += ", color=red, fontcolor=red, style=dashed"
+		}
+		fmt.Fprintf(w, "  %q -> %q [%s];\n", graphNodeID(edge.From), graphNodeID(edge.To), attributes)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// mermaidText escapes the quotes Mermaid labels can't hold.
+func mermaidText(text string) string {
+	return strings.Replace(text, "\"", "#quot;", -1)
+}
+
+// writeMermaid writes a Mermaid flowchart with a subgraph per namespace. Broken edges and orphan
+// nodes are red and dashed.
+func writeMermaid(w io.Writer, graph *Graph) {
+	fmt.Fprintf(w, "flowchart LR\n")
+	fmt.Fprintf(w, "  classDef orphan stroke:#d00,stroke-width:2px,stroke-dasharray:5 5,color:#d00\n")
+	ids := make(map[*GraphNode]string)
+	orphans := make([]string, 0)
+	namespace := ""
+	open := false
+	for i, node := range graph.Nodes("") {
+		if !open || node.Namespace != namespace {
+			if open {
+				fmt.Fprintf(w, "  end\n")
+			}
+			namespace, open = node.Namespace, true
+			fmt.Fprintf(w, "  subgraph ns%d[\"%s\"]\n", i, mermaidText(namespace))
+		}
+		ids[node] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(w, "    %s[\"%s\"]\n", ids[node], mermaidText(nodeLabel(node)))
+		if graph.Orphan(node) {
+			orphans = append(orphans, ids[node])
+		}
+	}
+	if open {
+		fmt.Fprintf(w, "  end\n")
+	}
+	broken := make([]string, 0)
+	for i, edge := range graph.Edges() {
+		arrow := "-->"
+		if edge.Broken {
+			arrow = "-.->"
+			broken = append(broken, fmt.Sprintf("%d", i))
+		}
+		if label := edgeLabel(edge); label != "" {
+			fmt.Fprintf(w, "  %s %s|\"%s\"| %s\n", ids[edge.From], arrow, mermaidText(label), ids[edge.To])
+		} else {
+			fmt.Fprintf(w, "  %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+		}
+	}
+	if len(orphans) > 0 {
+		fmt.Fprintf(w, "  class %s orphan\n", strings.Join(orphans, ","))
+	}
+	if len(broken) > 0 {
+		fmt.Fprintf(w, "  linkStyle %s stroke:#d00,stroke-width:2px,color:#d00\n", strings.Join(broken, ","))
+	}
+}
+
+func writeGraphJSON(w io.Writer, graph *Graph) error {
+	export := GraphExport{Nodes: make([]GraphNodeExport, 0), Edges: make([]GraphEdgeExport, 0)}
+	for _, node := range graph.Nodes("") {
+		export.Nodes = append(export.Nodes, GraphNodeExport{
+			ID:           graphNodeID(node),
+			Kind:         node.Kind,
+			Namespace:    node.Namespace,
+			Name:         node.Name,
+			Missing:      node.Missing,
+			Orphan:       graph.Orphan(node),
+			Ready:        node.Kind == kindPod && node.Ready,
+			ExternalName: node.ExternalName,
+		})
+	}
+	for _, edge := range graph.Edges() {
+		export.Edges = append(export.Edges, GraphEdgeExport{
+			From:     graphNodeID(edge.From),
+			To:       graphNodeID(edge.To),
+			Relation: edge.Relation,
+			Host:     edge.Host,
+			Path:     edge.Path,
+			Port:     edge.Port,
+			Broken:   edge.Broken,
+			Reason:   edge.Reason,
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&export)
+}
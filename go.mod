@@ -6,7 +6,7 @@ require (
 	github.com/cheggaaa/pb v2.0.7+incompatible
 	github.com/jbenet/go-is-domain v1.0.5
 	github.com/mattn/go-colorable v0.1.2 // indirect
-	github.com/mattn/go-isatty v0.0.10 // indirect
+	github.com/mattn/go-isatty v0.0.10
 	github.com/urfave/cli/v2 v2.2.0
 	golang.org/x/sys v0.0.0-20191128015809-6d18c012aee9 // indirect
 	gopkg.in/VividCortex/ewma.v1 v1.1.1 // indirect
@@ -19,4 +19,5 @@ require (
 	k8s.io/api v0.17.0
 	k8s.io/apimachinery v0.17.0
 	k8s.io/client-go v0.17.0
+	sigs.k8s.io/yaml v1.1.0
 )
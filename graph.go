@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Relations of the edges of the dependency graph, in the direction traffic flows.
+const (
+	relationRoutes  = "routes"   // an ingress routes to a service
+	relationSelects = "selects"  // a service selects a pod
+	relationOwnedBy = "owned-by" // a pod or workload is controlled by a workload
+)
+
+// graphKinds are the kinds the dependency graph links. Checkers only load the kinds they read, the
+// route report and the graph command load all of them.
+var graphKinds = []string{kindIngress, kindService, kindPod, kindReplicaSet, kindDeployment, kindDaemonSet, kindStatefulSet}
+
+// GraphNode is an object of the dependency graph.
+type GraphNode struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Missing nodes are referenced by an edge but don't exist.
+	Missing bool
+	// Ready tells whether a pod receives traffic. Pods read from manifests have no status and count as ready.
+	Ready bool
+	// ExternalName is the DNS name an ExternalName service routes to.
+	ExternalName string
+	object       interface{}
+}
+
+// GraphEdge links two nodes. Broken edges can't carry traffic, Reason tells why.
+type GraphEdge struct {
+	From     *GraphNode
+	To       *GraphNode
+	Relation string
+	// Host, Path and Port are the ingress rule and service port of a routes edge.
+	Host   string
+	Path   string
+	Port   string
+	Broken bool
+	Reason string
+}
+
+// Graph holds the dependencies between the objects of a snapshot: ingresses route to services,
+// services select pods, and pods are owned by replica sets, which are owned by deployments, and so on.
+type Graph struct {
+	nodes map[string]*GraphNode
+	out   map[*GraphNode][]*GraphEdge
+	in    map[*GraphNode][]*GraphEdge
+}
+
+func newGraph() *Graph {
+	return &Graph{nodes: make(map[string]*GraphNode), out: make(map[*GraphNode][]*GraphEdge), in: make(map[*GraphNode][]*GraphEdge)}
+}
+
+func nodeKey(kind string, namespace string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// Node returns the node of the object, or nil if the graph doesn't have it.
+func (g *Graph) Node(kind string, namespace string, name string) *GraphNode {
+	return g.nodes[nodeKey(kind, namespace, name)]
+}
+
+// node returns the node of the object, adding it if needed.
+func (g *Graph) node(kind string, namespace string, name string) *GraphNode {
+	key := nodeKey(kind, namespace, name)
+	node, ok := g.nodes[key]
+	if !ok {
+		node = &GraphNode{Kind: kind, Namespace: namespace, Name: name}
+		g.nodes[key] = node
+	}
+	return node
+}
+
+// missing returns the node of an object that is referenced but doesn't exist.
+func (g *Graph) missing(kind string, namespace string, name string) *GraphNode {
+	node := g.node(kind, namespace, name)
+	node.Missing = true
+	return node
+}
+
+func (g *Graph) addEdge(edge *GraphEdge) {
+	g.out[edge.From] = append(g.out[edge.From], edge)
+	g.in[edge.To] = append(g.in[edge.To], edge)
+}
+
+// Nodes returns the nodes of the kind, or of every kind if blank, sorted by namespace, kind and name.
+func (g *Graph) Nodes(kind string) []*GraphNode {
+	nodes := make([]*GraphNode, 0)
+	for _, node := range g.nodes {
+		if kind == "" || node.Kind == kind {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodeKey(nodes[i].Namespace, nodes[i].Kind, nodes[i].Name) < nodeKey(nodes[j].Namespace, nodes[j].Kind, nodes[j].Name)
+	})
+	return nodes
+}
+
+// Out returns the edges of the relation leaving the node.
+func (g *Graph) Out(node *GraphNode, relation string) []*GraphEdge {
+	return filterEdges(g.out[node], relation)
+}
+
+// In returns the edges of the relation arriving at the node.
+func (g *Graph) In(node *GraphNode, relation string) []*GraphEdge {
+	return filterEdges(g.in[node], relation)
+}
+
+func filterEdges(edges []*GraphEdge, relation string) []*GraphEdge {
+	filtered := make([]*GraphEdge, 0, len(edges))
+	for _, edge := range edges {
+		if edge.Relation == relation {
+			filtered = append(filtered, edge)
+		}
+	}
+	return filtered
+}
+
+// Owner returns the workload at the top of the owner chain of the node, the node itself if it has no owner.
+func (g *Graph) Owner(node *GraphNode) *GraphNode {
+	for seen := map[*GraphNode]bool{node: true}; ; {
+		owners := g.Out(node, relationOwnedBy)
+		if len(owners) == 0 || seen[owners[0].To] {
+			return node
+		}
+		node = owners[0].To
+		seen[node] = true
+	}
+}
+
+// Graph returns the dependency graph of the objects in the snapshot, building it on first use.
+func (s *Snapshot) Graph() (*Graph, error) {
+	if s.graph != nil {
+		return s.graph, nil
+	}
+	graph, err := buildGraph(s)
+	if err != nil {
+		return nil, err
+	}
+	s.graph = graph
+	return graph, nil
+}
+
+// buildGraph adds a node for every object of the graph kinds the snapshot holds and links them.
+// References to objects that don't exist end in missing nodes over broken edges.
+func buildGraph(snapshot *Snapshot) (*Graph, error) {
+	graph := newGraph()
+	for _, kind := range graphKinds {
+		for _, obj := range snapshot.objects(kind) {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return nil, err
+			}
+			node := graph.node(kind, accessor.GetNamespace(), accessor.GetName())
+			node.object = obj
+			switch typed := obj.(type) {
+			case *v1.Pod:
+				node.Ready = podReady(typed)
+			case *v1.Service:
+				node.ExternalName = typed.Spec.ExternalName
+			}
+		}
+	}
+
+	ingresses, err := snapshot.Ingresses()
+	if err != nil {
+		return nil, err
+	}
+	for _, ingress := range ingresses {
+		from := graph.node(kindIngress, ingress.Namespace, ingress.Name)
+		if backend := ingress.Spec.defaultBackend(); backend != nil {
+			linkIngressBackend(graph, snapshot, from, "", "", *backend)
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				linkIngressBackend(graph, snapshot, from, rule.Host, path.Path, path.Backend)
+			}
+		}
+	}
+
+	for _, service := range snapshot.Services() {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		from := graph.node(kindService, service.Namespace, service.Name)
+		selector := labels.SelectorFromSet(service.Spec.Selector)
+		pods, err := snapshot.Pods(service.Namespace, selector)
+		if err != nil {
+			graph.addEdge(&GraphEdge{From: from, To: graph.missing(kindPod, service.Namespace, selector.String()), Relation: relationSelects, Broken: true, Reason: err.Error()})
+			continue
+		}
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+		for _, pod := range pods {
+			graph.addEdge(&GraphEdge{From: from, To: graph.Node(kindPod, pod.Namespace, pod.Name), Relation: relationSelects})
+		}
+	}
+
+	// Owners that aren't in the snapshot, e.g. jobs, are added as plain nodes.
+	for _, kind := range []string{kindPod, kindReplicaSet} {
+		for _, obj := range snapshot.objects(kind) {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return nil, err
+			}
+			from := graph.Node(kind, accessor.GetNamespace(), accessor.GetName())
+			for _, owner := range accessor.GetOwnerReferences() {
+				if owner.Controller == nil || !*owner.Controller {
+					continue
+				}
+				to := graph.node(strings.ToLower(owner.Kind), accessor.GetNamespace(), owner.Name)
+				graph.addEdge(&GraphEdge{From: from, To: to, Relation: relationOwnedBy})
+			}
+		}
+	}
+	return graph, nil
+}
+
+// linkIngressBackend adds the edge from the ingress to the service of the backend. Backends routing
+// to other resources than services are not linked.
+func linkIngressBackend(graph *Graph, snapshot *Snapshot, from *GraphNode, host string, path string, backend IngressBackend) {
+	serviceName, servicePort, ok := backend.service()
+	if !ok {
+		return
+	}
+	edge := &GraphEdge{From: from, Relation: relationRoutes, Host: host, Path: path, Port: servicePort.String()}
+	service, err := snapshot.Service(from.Namespace, serviceName)
+	switch {
+	case err != nil:
+		edge.To = graph.missing(kindService, from.Namespace, serviceName)
+		edge.Broken, edge.Reason = true, err.Error()
+	case findServicePort(service, servicePort) == nil:
+		edge.To = graph.Node(kindService, service.Namespace, service.Name)
+		edge.Broken, edge.Reason = true, fmt.Sprintf("Service doesn't expose ingress port %s", servicePort.String())
+	default:
+		edge.To = graph.Node(kindService, service.Namespace, service.Name)
+	}
+	graph.addEdge(edge)
+}
+
+// podReady tells whether the pod is ready. Pods without any status, read from manifests or stood
+// in for by templates, are assumed to be.
+func podReady(pod *v1.Pod) bool {
+	if pod.Status.Phase == "" && len(pod.Status.Conditions) == 0 {
+		return true
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Routes returns the routes traffic can take: every service with a ready pod, or an external name,
+// and every ingress rule routing to one of them over an unbroken edge.
+func (g *Graph) Routes() []Route {
+	routes := make([]Route, 0)
+	serviceRoutes := make(map[*GraphNode]Route)
+	for _, service := range g.Nodes(kindService) {
+		if service.Missing {
+			continue
+		}
+		route := Route{Namespace: service.Namespace, Service: service.Name, ExternalName: service.ExternalName}
+		workloads := make(map[string]bool)
+		for _, edge := range g.Out(service, relationSelects) {
+			if edge.Broken {
+				continue
+			}
+			route.Pods++
+			if edge.To.Ready {
+				route.ReadyPods++
+				owner := g.Owner(edge.To)
+				workloads[owner.Kind+"/"+owner.Name] = true
+			}
+		}
+		if route.ReadyPods == 0 && route.ExternalName == "" {
+			continue
+		}
+		for workload := range workloads {
+			route.Workloads = append(route.Workloads, workload)
+		}
+		sort.Strings(route.Workloads)
+		serviceRoutes[service] = route
+		routes = append(routes, route)
+	}
+
+	for _, ingress := range g.Nodes(kindIngress) {
+		for _, edge := range g.Out(ingress, relationRoutes) {
+			serviceRoute, ok := serviceRoutes[edge.To]
+			if edge.Broken || !ok {
+				continue
+			}
+			route := serviceRoute
+			route.Ingress, route.Host, route.Path, route.Port = ingress.Name, edge.Host, edge.Path, edge.Port
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
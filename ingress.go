@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cheggaaa/pb"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ingressClassAnnotation is the deprecated predecessor of spec.ingressClassName.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+type ingressChecker struct{}
+
+func init() {
+	registerChecker(ingressChecker{}, "ingress", "ingresses")
+}
+
+func (ingressChecker) Name() string        { return "ing" }
+func (ingressChecker) Description() string { return "validate ingress(s)" }
+func (ingressChecker) Kinds() []string     { return []string{kindIngress, kindIngressClass, kindService} }
+
+func (ingressChecker) Check(ctx context.Context, snapshot *Snapshot) ([]InventoryViolation, error) {
+	violations := make([]InventoryViolation, 0)
+	ingresses, err := snapshot.Ingresses()
+	if err != nil {
+		return nil, err
+	}
+	graph, err := snapshot.Graph()
+	if err != nil {
+		return nil, err
+	}
+	classesKnown := snapshot.IngressClassesKnown()
+
+	log.Printf("Examining ingress rules.\n")
+	bar := pb.StartNew(len(ingresses))
+	for _, ingress := range ingresses {
+		bar.Increment()
+
+		if _, ok := ingress.Annotations[ingressClassAnnotation]; ok {
+			violations = append(violations, InventoryViolation{Rule: "ING005", Reason: fmt.Sprintf("uses the deprecated %s annotation instead of spec.ingressClassName", ingressClassAnnotation), Kind: kindIngress, Name: ingress.Name, Namespace: ingress.Namespace})
+		}
+		if className := ingress.Spec.IngressClassName; className != nil && classesKnown && !snapshot.IngressClass(*className) {
+			violations = append(violations, InventoryViolation{Rule: "ING004", Reason: "references a missing ingress class", Kind: kindIngress, Reference: ResourceReference{Kind: kindIngressClass, Name: *className}, Name: ingress.Name, Namespace: ingress.Namespace})
+		}
+
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				violations = append(violations, InventoryViolation{Rule: "ING002", Reason: "no HTTP routes in ingress", Kind: kindIngress, Name: ingress.Name, Namespace: ingress.Namespace})
+			}
+		}
+		// The backends of the default backend and of every path are edges of the graph.
+		node := graph.Node(kindIngress, ingress.Namespace, ingress.Name)
+		edges := graph.Out(node, relationRoutes)
+		// Only an ingress whose every backend is a broken service backend routes nowhere. One that
+		// still routes some paths is misconfigured, not garbage.
+		if backends := ingress.Spec.backends(); len(backends) > 0 && len(edges) == len(backends) && graph.Orphan(node) {
+			violations = append(violations, InventoryViolation{Rule: "ING006", Reason: "none of the backends of the ingress work", Kind: kindIngress, Name: ingress.Name, Namespace: ingress.Namespace})
+		}
+		// An ingress is reported once per rule, so the broken hops are collected.
+		var missing, unexposed []*GraphEdge
+		for _, edge := range edges {
+			switch {
+			case edge.To.Missing:
+				missing = append(missing, edge)
+			case edge.Broken:
+				unexposed = append(unexposed, edge)
+			}
+		}
+		if len(missing) > 0 {
+			violations = append(violations, InventoryViolation{Rule: "ING001", Reason: "references a missing service: " + backendHops(missing, false), Kind: kindIngress, Reference: ResourceReference{Kind: kindService, Name: backendServices(missing)}, Name: ingress.Name, Namespace: ingress.Namespace})
+		}
+		if len(unexposed) > 0 {
+			violations = append(violations, InventoryViolation{Rule: "ING003", Reason: "the service doesn't expose the backend port: " + backendHops(unexposed, true), Kind: kindIngress, Reference: ResourceReference{Kind: kindService, Name: backendServices(unexposed)}, Name: ingress.Name, Namespace: ingress.Namespace})
+		}
+	}
+	bar.Finish()
+	return violations, nil
+}
+
+// backendHops describes the ingress rules of the edges and the service ports they route to.
+func backendHops(edges []*GraphEdge, withPort bool) string {
+	hops := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		rule := edge.Host + edge.Path
+		if rule == "" {
+			rule = "default backend"
+		}
+		target := edge.To.Name
+		if withPort {
+			target += ":" + edge.Port
+		}
+		hops = append(hops, rule+" -> "+target)
+	}
+	return strings.Join(hops, ", ")
+}
+
+// backendServices lists the services the edges route to, each once.
+func backendServices(edges []*GraphEdge) string {
+	names := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		if !contains(edge.To.Name, names) {
+			names = append(names, edge.To.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// findServicePort returns the port of the service matching the number or name, or nil.
+func findServicePort(service *v1.Service, port intstr.IntOrString) *v1.ServicePort {
+	for i, servicePort := range service.Spec.Ports {
+		if (port.Type == intstr.Int && servicePort.Port == port.IntVal) || (port.Type == intstr.String && servicePort.Name == port.StrVal) {
+			return &service.Spec.Ports[i]
+		}
+	}
+	return nil
+}
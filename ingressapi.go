@@ -0,0 +1,147 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/discovery"
+)
+
+// versionedKinds lists, most preferred first, the API versions of the kinds that are served at
+// different versions depending on the cluster. The client only knows some of them, so these kinds
+// are listed with the dynamic client and kept unstructured.
+var versionedKinds = map[string][]schema.GroupVersionResource{
+	kindIngress: {
+		{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"},
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses"},
+	},
+	kindIngressClass: {
+		{Group: "networking.k8s.io", Version: "v1", Resource: "ingressclasses"},
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingressclasses"},
+	},
+	kindEndpointSlice: {
+		{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"},
+		{Group: "discovery.k8s.io", Version: "v1beta1", Resource: "endpointslices"},
+	},
+}
+
+// discoverResources returns the API resources of every kind, with the versioned kinds resolved to the
+// most preferred version the server offers. Versioned kinds the server doesn't offer at all are absent.
+func discoverResources(discoveryClient discovery.DiscoveryInterface) (map[string]schema.GroupVersionResource, error) {
+	resources := make(map[string]schema.GroupVersionResource)
+	for kind, resource := range kindResources {
+		if _, versioned := versionedKinds[kind]; !versioned {
+			resources[kind] = resource
+		}
+	}
+	for kind, candidates := range versionedKinds {
+	candidates:
+		for _, candidate := range candidates {
+			served, err := discoveryClient.ServerResourcesForGroupVersion(candidate.GroupVersion().String())
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, resource := range served.APIResources {
+				if resource.Name == candidate.Resource {
+					resources[kind] = candidate
+					break candidates
+				}
+			}
+		}
+	}
+	return resources, nil
+}
+
+// Ingress is the version independent view of an ingress the checkers work with. Objects of the
+// extensions/v1beta1, networking.k8s.io/v1beta1 and networking.k8s.io/v1 APIs all decode into it.
+type Ingress struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              IngressSpec `json:"spec,omitempty"`
+}
+
+type IngressSpec struct {
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+	// Backend is the default backend of the beta APIs, DefaultBackend the one of v1.
+	Backend        *IngressBackend `json:"backend,omitempty"`
+	DefaultBackend *IngressBackend `json:"defaultBackend,omitempty"`
+	Rules          []IngressRule   `json:"rules,omitempty"`
+}
+
+type IngressRule struct {
+	Host string                `json:"host,omitempty"`
+	HTTP *HTTPIngressRuleValue `json:"http,omitempty"`
+}
+
+type HTTPIngressRuleValue struct {
+	Paths []HTTPIngressPath `json:"paths"`
+}
+
+type HTTPIngressPath struct {
+	Path    string         `json:"path,omitempty"`
+	Backend IngressBackend `json:"backend"`
+}
+
+// IngressBackend holds both the serviceName/servicePort of the beta APIs and the service of v1.
+type IngressBackend struct {
+	ServiceName string                        `json:"serviceName,omitempty"`
+	ServicePort intstr.IntOrString            `json:"servicePort,omitempty"`
+	Service     *IngressServiceBackend        `json:"service,omitempty"`
+	Resource    *v1.TypedLocalObjectReference `json:"resource,omitempty"`
+}
+
+type IngressServiceBackend struct {
+	Name string             `json:"name"`
+	Port ServiceBackendPort `json:"port,omitempty"`
+}
+
+type ServiceBackendPort struct {
+	Name   string `json:"name,omitempty"`
+	Number int32  `json:"number,omitempty"`
+}
+
+// service returns the service and port the backend routes to. Backends routing to other
+// resources return false.
+func (b IngressBackend) service() (string, intstr.IntOrString, bool) {
+	if b.Service != nil {
+		if b.Service.Port.Name != "" {
+			return b.Service.Name, intstr.FromString(b.Service.Port.Name), true
+		}
+		return b.Service.Name, intstr.FromInt(int(b.Service.Port.Number)), true
+	}
+	if b.ServiceName != "" {
+		return b.ServiceName, b.ServicePort, true
+	}
+	return "", intstr.IntOrString{}, false
+}
+
+// backends returns the default backend, if any, and the backend of every path.
+func (s IngressSpec) backends() []IngressBackend {
+	backends := make([]IngressBackend, 0)
+	if backend := s.defaultBackend(); backend != nil {
+		backends = append(backends, *backend)
+	}
+	for _, rule := range s.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+	return backends
+}
+
+// defaultBackend returns the default backend of either API shape, or nil.
+func (s IngressSpec) defaultBackend() *IngressBackend {
+	if s.DefaultBackend != nil {
+		return s.DefaultBackend
+	}
+	return s.Backend
+}
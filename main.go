@@ -1,28 +1,18 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 
-	"github.com/cheggaaa/pb"
-	isd "github.com/jbenet/go-is-domain"
 	"gopkg.in/yaml.v2"
-	v1apps "k8s.io/api/apps/v1"
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type ResourceReference struct {
@@ -33,9 +23,20 @@ type ResourceReference struct {
 
 type InventoryViolation struct {
 	Name      string            `json:",omitempty" yaml:",omitempty"`
+	Namespace string            `json:",omitempty" yaml:",omitempty"`
 	Kind      string            `json:",omitempty" yaml:",omitempty"`
 	Reference ResourceReference `json:",omitempty" yaml:",omitempty"`
 	Reason    string            `json:",omitempty" yaml:",omitempty"`
+	// Rule is the stable ID of the rule that found the violation, e.g. ING001.
+	Rule     string `json:",omitempty" yaml:",omitempty"`
+	RuleName string `json:",omitempty" yaml:",omitempty"`
+	Severity string `json:",omitempty" yaml:",omitempty"`
+	Category string `json:",omitempty" yaml:",omitempty"`
+	// UID and ResourceVersion identify the exact object the violation was found on.
+	UID             string `json:",omitempty" yaml:",omitempty"`
+	ResourceVersion string `json:",omitempty" yaml:",omitempty"`
+	// SuppressedBy describes the annotation that suppressed the violation.
+	SuppressedBy string `json:",omitempty" yaml:",omitempty"`
 }
 
 type ResourceInventoryList struct {
@@ -43,27 +44,67 @@ type ResourceInventoryList struct {
 }
 
 type Namespace struct {
+	// Cluster is the kubeconfig context the namespace was validated in, blank for single cluster runs.
+	Cluster   string               `json:",omitempty" yaml:",omitempty"`
 	Namespace string               `json:",omitempty" yaml:",omitempty"`
 	Items     []InventoryViolation `json:",omitempty" yaml:",omitempty"`
 }
 
-type NamespaceList struct {
-	Namespaces []Namespace `json:",omitempty" yaml:",omitempty"`
+// Route is a path traffic can take, from an ingress rule or a service to ready pods and the
+// workloads owning them. Service routes have no ingress and cover all ports of the service.
+type Route struct {
+	Cluster      string   `json:",omitempty" yaml:",omitempty"`
+	Namespace    string   `json:",omitempty" yaml:",omitempty"`
+	Ingress      string   `json:",omitempty" yaml:",omitempty"`
+	Host         string   `json:",omitempty" yaml:",omitempty"`
+	Path         string   `json:",omitempty" yaml:",omitempty"`
+	Service      string   `json:",omitempty" yaml:",omitempty"`
+	Port         string   `json:",omitempty" yaml:",omitempty"`
+	ExternalName string   `json:",omitempty" yaml:",omitempty"`
+	Workloads    []string `json:",omitempty" yaml:",omitempty"`
+	Pods         int      `json:",omitempty" yaml:",omitempty"`
+	ReadyPods    int      `json:",omitempty" yaml:",omitempty"`
 }
 
-var inCluster bool
+type ValidatorTiming struct {
+	Cluster    string `json:",omitempty" yaml:",omitempty"`
+	Validator  string `json:",omitempty" yaml:",omitempty"`
+	Duration   string `json:",omitempty" yaml:",omitempty"`
+	Violations int    `json:",omitempty" yaml:",omitempty"`
+	Suppressed int    `json:",omitempty" yaml:",omitempty"`
+}
 
-func betterPanic(message string, args ...string) {
-	temp := fmt.Sprintf(message, args)
-	fmt.Printf("%s\n\n", temp)
-	os.Exit(1)
+type Summary struct {
+	Total      int            `json:",omitempty" yaml:",omitempty"`
+	Namespaces map[string]int `json:",omitempty" yaml:",omitempty"`
+	Kinds      map[string]int `json:",omitempty" yaml:",omitempty"`
+	Severities map[string]int `json:",omitempty" yaml:",omitempty"`
+	Suppressed int            `json:",omitempty" yaml:",omitempty"`
+	Baselined  int            `json:",omitempty" yaml:",omitempty"`
 }
 
-func homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
-	}
-	return os.Getenv("USERPROFILE") // windows
+// ClusterSummary counts the results of a cluster in a multi-cluster run. Failed is set when the
+// cluster couldn't be validated at all.
+type ClusterSummary struct {
+	Cluster    string `json:",omitempty" yaml:",omitempty"`
+	Violations int    `json:",omitempty" yaml:",omitempty"`
+	Suppressed int    `json:",omitempty" yaml:",omitempty"`
+	Baselined  int    `json:",omitempty" yaml:",omitempty"`
+	Errors     int    `json:",omitempty" yaml:",omitempty"`
+	Failed     bool   `json:",omitempty" yaml:",omitempty"`
+}
+
+type NamespaceList struct {
+	Namespaces []Namespace       `json:",omitempty" yaml:",omitempty"`
+	Suppressed []Namespace       `json:",omitempty" yaml:",omitempty"`
+	Fixed      []BaselineEntry   `json:",omitempty" yaml:",omitempty"`
+	Timings    []ValidatorTiming `json:",omitempty" yaml:",omitempty"`
+	Errors     []ReportError     `json:",omitempty" yaml:",omitempty"`
+	Warnings   []ReportError     `json:",omitempty" yaml:",omitempty"`
+	Summary    *Summary          `json:",omitempty" yaml:",omitempty"`
+	Clusters   []ClusterSummary  `json:",omitempty" yaml:",omitempty"`
+	// Routes lists the successful routes, when asked for with --routes.
+	Routes []Route `json:",omitempty" yaml:",omitempty"`
 }
 
 func contains(s string, array []string) bool {
@@ -75,76 +116,235 @@ func contains(s string, array []string) bool {
 	return false
 }
 
-func printReport(orphans map[string]ResourceInventoryList, outputMode string) {
-	namespaceList := NamespaceList{}
-	for namespace, ResourceInventoryList := range orphans {
-		orphanedItems := make([]InventoryViolation, 0)
+func countViolations(orphans map[string]ResourceInventoryList) int {
+	count := 0
+	for _, inventoryList := range orphans {
+		count += len(inventoryList.Items)
+	}
+	return count
+}
 
-		for _, reason := range ResourceInventoryList.Items {
-			orphanedItems = append(orphanedItems, reason)
+// summarize counts the violations of a cluster into the summary. Namespaces are prefixed with the
+// cluster in multi-cluster runs.
+func summarize(summary *Summary, cluster string, orphans map[string]ResourceInventoryList) {
+	for namespace, inventoryList := range orphans {
+		for _, reason := range inventoryList.Items {
+			summary.Total++
+			summary.Namespaces[namespaceLabel(cluster, namespace)]++
+			summary.Kinds[reason.Kind]++
+			if reason.Severity != "" {
+				summary.Severities[reason.Severity]++
+			}
 		}
+	}
+}
 
-		ns := Namespace{Namespace: namespace, Items: orphanedItems}
-		namespaceList.Namespaces = append(namespaceList.Namespaces, ns)
+// namespaceLabel names the namespace of a cluster, e.g. prod/default.
+func namespaceLabel(cluster string, namespace string) string {
+	if cluster == "" {
+		return namespace
 	}
+	return cluster + "/" + namespace
+}
 
-	if len(orphans) == 0 {
-		fmt.Printf("You don't have any problems, at all!\n")
-	} else {
-		if "text" == outputMode {
-			for namespace, ResourceInventoryList := range orphans {
-				fmt.Printf("\n==============================\n")
-				fmt.Printf("Namespace: %s\n", namespace)
-				fmt.Printf("==============================\n")
-
-				if len(ResourceInventoryList.Items) > 0 {
-					fmt.Printf("\nOrphaned Items\n")
-					for ingress, reason := range ResourceInventoryList.Items {
-						fmt.Printf("* %s, %s\n", ingress, reason)
-					}
-				}
-				fmt.Println()
-			}
-		} else if "yaml" == outputMode {
-			pretty, err := yaml.Marshal(&namespaceList)
-			if err != nil {
-				betterPanic(err.Error())
-			}
-			fmt.Println(string(pretty))
-		} else if "json" == outputMode {
-			pretty, err := json.MarshalIndent(namespaceList, "", "    ")
-			if err != nil {
-				betterPanic(err.Error())
-			}
-			fmt.Println(string(pretty))
+// reportFromInventory flattens validation results into the report layout used by printReport.
+func reportFromInventory(orphans map[string]ResourceInventoryList) NamespaceList {
+	report := NamespaceList{}
+	for namespace, inventoryList := range orphans {
+		items := make([]InventoryViolation, 0)
+		for _, reason := range inventoryList.Items {
+			items = append(items, reason)
 		}
+		report.Namespaces = append(report.Namespaces, Namespace{Namespace: namespace, Items: items})
 	}
+	return report
 }
 
-func main() {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// buildReport merges the results of one or more clusters into a single report. The summary is
+// only computed when the validator timings were kept, clusters are only listed when there are several.
+func buildReport(results []*validationResult) NamespaceList {
+	report := NamespaceList{}
+	var summary *Summary
+	for _, result := range results {
+		for _, namespace := range reportFromInventory(result.orphans).Namespaces {
+			namespace.Cluster = result.cluster
+			report.Namespaces = append(report.Namespaces, namespace)
+		}
+		for _, namespace := range reportFromInventory(result.suppressed).Namespaces {
+			namespace.Cluster = result.cluster
+			report.Suppressed = append(report.Suppressed, namespace)
+		}
+		report.Fixed = append(report.Fixed, result.fixed...)
+		for _, route := range result.routes {
+			route.Cluster = result.cluster
+			report.Routes = append(report.Routes, route)
+		}
+		for _, reportError := range result.errors {
+			reportError.Cluster = result.cluster
+			report.Errors = append(report.Errors, reportError)
+		}
+		for _, reportError := range result.warnings {
+			reportError.Cluster = result.cluster
+			report.Warnings = append(report.Warnings, reportError)
+		}
+		if result.timings == nil {
+			continue
+		}
+		for _, timing := range result.timings {
+			timing.Cluster = result.cluster
+			report.Timings = append(report.Timings, timing)
+		}
+		if summary == nil {
+			summary = &Summary{Namespaces: make(map[string]int), Kinds: make(map[string]int), Severities: make(map[string]int)}
+		}
+		summarize(summary, result.cluster, result.orphans)
+		summary.Suppressed += countViolations(result.suppressed)
+		summary.Baselined += result.baselined
+	}
+	report.Summary = summary
+
+	if len(results) > 1 {
+		for _, result := range results {
+			report.Clusters = append(report.Clusters, ClusterSummary{
+				Cluster:    result.cluster,
+				Violations: countViolations(result.orphans),
+				Suppressed: countViolations(result.suppressed),
+				Baselined:  result.baselined,
+				Errors:     len(result.errors),
+				Failed:     result.failed,
+			})
+		}
+	}
+	if report.Fixed != nil {
+		sortBaselineEntries(report.Fixed)
+	}
+	return sortedReport(report)
+}
+
+func printReport(results []*validationResult, outputMode string) error {
+	outputMode = defaultOutputMode(outputMode)
+	namespaceList := buildReport(results)
 
-	var kubeconfig string
+	if "kubectl" == outputMode {
+		printKubectlScript(os.Stdout, namespaceList)
+		return nil
+	}
+
+	switch outputMode {
+	case "text":
+		// The greeting is only for humans, yaml and json have to stay parseable.
+		if len(namespaceList.Namespaces) == 0 && len(namespaceList.Errors) == 0 {
+			fmt.Printf("You don't have any problems, at all!\n")
+		}
+		if len(namespaceList.Namespaces) > 0 || len(namespaceList.Errors) > 0 || len(namespaceList.Routes) > 0 || len(namespaceList.Fixed) > 0 || len(namespaceList.Warnings) > 0 || namespaceList.Summary != nil {
+			printTextReport(os.Stdout, namespaceList, stdoutIsTerminal())
+		}
+	case "yaml":
+		pretty, err := yaml.Marshal(&namespaceList)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(pretty))
+	case "json":
+		pretty, err := json.MarshalIndent(namespaceList, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(pretty))
+	default:
+		return fmt.Errorf("Unknown output format %s, use one of %s", outputMode, strings.Join(outputModes, ", "))
+	}
+	return nil
+}
+
+func main() {
+	var connection connectionOptions
+	var asGroups cli.StringSlice
 	var outputMode string
+	var fromFile string
+	var snapshotFile string
+	var reportFile string
+	var dryRun bool
+	var minSeverity string
+	var configFile string
+	var baselineFile string
+	var failOn string
+	var findingsExitCode int
+	var writeBaselineFile string
+	var allContexts bool
+	var contexts cli.StringSlice
+	var backupDir string
+	var restoreKind string
+	var restoreName string
+	var preflightCleanup bool
+	var routes bool
+	var roleFile string
 	namespace := ""
-	home := homeDir()
-	kubeConfigPath := ""
-	if home != "" {
-		kubeConfigPath = filepath.Join(home, ".kube", "config")
-	}
 
 	flags := []cli.Flag{
 		&cli.StringFlag{
 			Name:        "kubeconfig",
-			Value:       kubeConfigPath,
-			Usage:       "absolute path to the kubeconfig file",
-			Destination: &kubeconfig,
+			Value:       "",
+			Usage:       "absolute path to the kubeconfig file ($KUBECONFIG or ~/.kube/config if blank, the in-cluster service account if there is none)",
+			Destination: &connection.kubeconfig,
+		},
+		&cli.StringFlag{
+			Name:        "context",
+			Value:       "",
+			Usage:       "kubeconfig context to use (the current context if blank)",
+			Destination: &connection.context,
+		},
+		&cli.StringFlag{
+			Name:        "cluster",
+			Value:       "",
+			Usage:       "kubeconfig cluster to use (the cluster of the context if blank)",
+			Destination: &connection.cluster,
+		},
+		&cli.StringFlag{
+			Name:        "as",
+			Value:       "",
+			Usage:       "user to impersonate",
+			Destination: &connection.as,
+		},
+		&cli.StringSliceFlag{
+			Name:        "as-group",
+			Usage:       "group to impersonate, can be repeated",
+			Destination: &asGroups,
+		},
+		&cli.StringFlag{
+			Name:        "request-timeout",
+			Value:       "",
+			Usage:       "timeout of a single API request, e.g. 30s (no timeout if blank or 0)",
+			Destination: &connection.requestTimeout,
+		},
+		&cli.StringFlag{
+			Name:        "ca-file",
+			Value:       "",
+			Usage:       "certificate authority to verify the API server with instead of the one in the kubeconfig",
+			Destination: &connection.caFile,
+		},
+		&cli.BoolFlag{
+			Name:        "insecure-skip-tls-verify",
+			Usage:       "don't verify the certificate of the API server, this makes the connection insecure",
+			Destination: &connection.insecureSkipTLSVerify,
+		},
+		&cli.Float64Flag{
+			Name:        "qps",
+			Value:       0,
+			Usage:       "queries per second allowed against the API server (the client default of 5 if 0)",
+			Destination: &connection.qps,
+		},
+		&cli.IntFlag{
+			Name:        "burst",
+			Value:       0,
+			Usage:       "burst of queries allowed above --qps (the client default of 10 if 0)",
+			Destination: &connection.burst,
 		},
 		&cli.StringFlag{
 			Name:        "o",
 			Aliases:     []string{"output"},
-			Value:       "yaml",
-			Usage:       "output format (yaml, json, kubectl)",
+			Value:       "",
+			Usage:       "output format (text, yaml, json, kubectl), text when run interactively and yaml otherwise",
 			Destination: &outputMode,
 		},
 		&cli.StringFlag{
@@ -154,6 +354,170 @@ func main() {
 			Usage:       "limit to this namespace (all namespaces if blank)",
 			Destination: &namespace,
 		},
+		&cli.StringFlag{
+			Name:        "from-file",
+			Aliases:     []string{"f"},
+			Value:       "",
+			Usage:       "validate manifests from this file or directory instead of a live cluster",
+			Destination: &fromFile,
+		},
+		&cli.StringFlag{
+			Name:        "snapshot",
+			Value:       "",
+			Usage:       "validate a snapshot archive saved with 'snapshot save' instead of a live cluster",
+			Destination: &snapshotFile,
+		},
+		&cli.StringFlag{
+			Name:        "min-severity",
+			Value:       "",
+			Usage:       "only report violations at or above this severity (info, warning, error, critical)",
+			Destination: &minSeverity,
+		},
+		&cli.StringFlag{
+			Name:        "config",
+			Value:       "",
+			Usage:       "configuration file enabling checks, setting thresholds and exclusions",
+			Destination: &configFile,
+		},
+	}
+
+	validateFlags := append(flags,
+		&cli.StringFlag{
+			Name:        "baseline",
+			Value:       "",
+			Usage:       "only report findings that are not in this baseline file, and list the baseline entries that were fixed",
+			Destination: &baselineFile,
+		},
+		&cli.StringFlag{
+			Name:        "write-baseline",
+			Value:       "",
+			Usage:       "record the current findings in this baseline file",
+			Destination: &writeBaselineFile,
+		},
+		&cli.StringFlag{
+			Name:        "fail-on",
+			Value:       "",
+			Usage:       "exit with --findings-exit-code when findings at or above this severity are reported (any finding if blank, never if none)",
+			Destination: &failOn,
+		},
+		&cli.BoolFlag{
+			Name:        "all-contexts",
+			Usage:       "validate every context of the kubeconfig concurrently and merge the reports",
+			Destination: &allContexts,
+		},
+		&cli.StringSliceFlag{
+			Name:        "contexts",
+			Usage:       "validate these contexts concurrently and merge the reports, e.g. a,b,c",
+			Destination: &contexts,
+		},
+		&cli.BoolFlag{
+			Name:        "routes",
+			Usage:       "also report every successful route from ingresses and services to ready pods",
+			Destination: &routes,
+		},
+		&cli.IntFlag{
+			Name:        "findings-exit-code",
+			Value:       exitFindings,
+			Usage:       "exit code used when findings at or above --fail-on are reported",
+			Destination: &findingsExitCode,
+		},
+	)
+
+	// clients builds the API clients from the connection flags.
+	clients := func() *clientFactory {
+		connection.asGroups = asGroups.Value()
+		return newClientFactory(connection)
+	}
+
+	// prepareValidation checks the validation flags and loads the configuration.
+	prepareValidation := func() error {
+		if outputMode != "" && !contains(outputMode, outputModes) {
+			return fmt.Errorf("Unknown output format %s, use one of %s", outputMode, strings.Join(outputModes, ", "))
+		}
+		if _, err := parseSeverity(minSeverity); err != nil {
+			return err
+		}
+		if failOn != failOnNone {
+			if _, err := parseSeverity(failOn); err != nil {
+				return err
+			}
+		}
+		loaded, err := loadConfig(configFile)
+		if err != nil {
+			return err
+		}
+		config = loaded
+		return nil
+	}
+
+	// runValidation validates the selected cluster(s) with the checkers, applies the baseline and
+	// severity filters and prints the report.
+	runValidation := func(checks []Checker, keepTimings bool) error {
+		if err := prepareValidation(); err != nil {
+			return err
+		}
+		var results []*validationResult
+		if allContexts || len(contexts.Value()) > 0 {
+			if fromFile != "" || snapshotFile != "" {
+				return errors.New("Contexts can't be validated from files or snapshots")
+			}
+			connection.asGroups = asGroups.Value()
+			selected, err := clusterContexts(connection, allContexts, contexts.Value())
+			if err != nil {
+				return err
+			}
+			results = validateClusters(connection, selected, namespace, checks, routes)
+		} else {
+			result, err := validate(clients(), fromFile, snapshotFile, namespace, checks, routes)
+			if err != nil {
+				return err
+			}
+			results = []*validationResult{result}
+		}
+		if !keepTimings {
+			for _, result := range results {
+				result.timings = nil
+			}
+		}
+
+		if writeBaselineFile != "" {
+			recorded, err := writeBaseline(writeBaselineFile, results)
+			if err != nil {
+				return err
+			}
+			log.Printf("Recorded %d finding(s) in %s\n", recorded, writeBaselineFile)
+		}
+		var baseline Baseline
+		if baselineFile != "" {
+			var err error
+			if baseline, err = readBaseline(baselineFile); err != nil {
+				return err
+			}
+		}
+		partial, failing := false, 0
+		for _, result := range results {
+			if baselineFile != "" {
+				result.applyBaseline(baseline, namespace)
+			}
+			result.orphans = filterViolations(result.orphans, atLeastSeverity(minSeverity))
+			partial = partial || len(result.errors) > 0
+			failing += failingFindings(result.orphans, failOn)
+		}
+		if err := printReport(results, outputMode); err != nil {
+			return err
+		}
+		// A run that reached no cluster at all is a connection failure, not a partial result.
+		if code := failedClustersExitCode(results); code != exitClean {
+			return cli.Exit("No cluster could be validated", code)
+		}
+		// Incomplete results can't vouch for a clean cluster, so they take precedence over findings.
+		if partial {
+			return cli.Exit("", exitPartial)
+		}
+		if failing > 0 {
+			return cli.Exit("", findingsExitCode)
+		}
+		return nil
 	}
 
 	app := &cli.App{
@@ -165,58 +529,279 @@ func main() {
 				Name:    "validate",
 				Aliases: []string{"val", "check"},
 				Usage:   "validate resources",
+				Subcommands: checkerCommands(validateFlags, func(c *cli.Context, checks []Checker) error {
+					return runValidation(checks, false)
+				}),
+				Flags: validateFlags,
+				Action: func(c *cli.Context) error {
+					return runValidation(enabledCheckers(), true)
+				},
+			},
+			{
+				Name:  "preflight",
+				Usage: "check the credentials have the permissions the validators need",
+				Flags: append(flags,
+					&cli.BoolFlag{
+						Name:        "cleanup",
+						Usage:       "also check the permissions cleanup needs",
+						Destination: &preflightCleanup,
+					},
+					&cli.BoolFlag{
+						Name:        "routes",
+						Usage:       "also check the permissions the route report needs",
+						Destination: &routes,
+					},
+					&cli.StringFlag{
+						Name:        "role-file",
+						Value:       "",
+						Usage:       "write the Role and ClusterRole granting the missing permissions to this file instead of printing them",
+						Destination: &roleFile,
+					},
+				),
+				Action: func(c *cli.Context) error {
+					if err := prepareValidation(); err != nil {
+						return err
+					}
+					api, err := clients().apiClients()
+					if err != nil {
+						return connectionError("Unable to connect to K8s", err)
+					}
+					rows := preflightRows(enabledCheckers(), preflightCleanup, routes, api.resources, namespace)
+					allowed, err := checkPermissions(api.clientset, api.resources, rows, namespace)
+					if err != nil {
+						return connectionError("Unable to review permissions", err)
+					}
+					if printPermissionMatrix(os.Stdout, rows, api.resources, allowed, stdoutIsTerminal()) == 0 {
+						fmt.Printf("\nAll checks have the permissions they need.\n")
+						return nil
+					}
+
+					namespaced, clusterWide := missingRules(rows, api.resources, allowed, namespace)
+					if roleFile == "" {
+						fmt.Printf("\nThese roles grant the missing permissions:\n\n")
+						if err := writeMissingRoles(os.Stdout, namespaced, clusterWide, namespace); err != nil {
+							return err
+						}
+					} else {
+						f, err := os.Create(roleFile)
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						if err := writeMissingRoles(f, namespaced, clusterWide, namespace); err != nil {
+							return err
+						}
+						fmt.Printf("\nWrote the roles granting the missing permissions to %s\n", roleFile)
+					}
+					return cli.Exit("", exitAuth)
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "compare two json or yaml reports",
+				ArgsUsage: "<old-report> <new-report>",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return errors.New("Two reports are required")
+					}
+					old, err := readReport(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					new, err := readReport(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					return printDiff(diffReports(old, new), outputMode)
+				},
+			},
+			{
+				Name:  "graph",
+				Usage: "export the dependency graph of ingresses, services, workloads and pods (dot, mermaid or json)",
+				Flags: flags,
+				Action: func(c *cli.Context) error {
+					mode := outputMode
+					if mode == "" {
+						mode = "dot"
+					}
+					if !contains(mode, graphOutputModes) {
+						return fmt.Errorf("Unknown graph output format %s, use one of %s", mode, strings.Join(graphOutputModes, ", "))
+					}
+					snapshot, err := loadState(context.Background(), clients(), fromFile, snapshotFile, namespace, graphKinds)
+					if err != nil {
+						return err
+					}
+					graph, err := snapshot.Graph()
+					if err != nil {
+						return err
+					}
+					if err := writeGraph(os.Stdout, graph, mode); err != nil {
+						return err
+					}
+					if len(snapshot.errors) > 0 {
+						return cli.Exit(fmt.Sprintf("%d list(s) failed, the graph is incomplete", len(snapshot.errors)), exitPartial)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "cleanup",
+				Usage: "delete what validate reports, using a reviewable plan",
 				Subcommands: []*cli.Command{
 					{
-						Name:    "ns",
-						Aliases: []string{"namespace", "namespaces"},
-						Usage:   "validate namespace(s)",
-						Flags:   flags,
+						Name:      "plan",
+						Usage:     "write the objects to delete to a plan file",
+						ArgsUsage: "<plan-file>",
+						Flags: append(flags, &cli.StringFlag{
+							Name:        "report",
+							Value:       "",
+							Usage:       "plan from this json or yaml validation report instead of running the validators",
+							Destination: &reportFile,
+						}),
 						Action: func(c *cli.Context) error {
-							orphans := validateNamespaces(kubeconfig)
-							printReport(orphans, outputMode)
+							if c.NArg() != 1 {
+								return errors.New("Plan file not specified")
+							}
+							var report NamespaceList
+							partial := false
+							if reportFile != "" {
+								var err error
+								report, err = readReport(reportFile)
+								if err != nil {
+									return err
+								}
+							} else {
+								if err := prepareValidation(); err != nil {
+									return err
+								}
+								result, err := validate(clients(), fromFile, snapshotFile, namespace, enabledCheckers(), false)
+								if err != nil {
+									return err
+								}
+								orphans := filterViolations(result.orphans, atLeastSeverity(minSeverity))
+								report = reportFromInventory(orphans)
+								partial = len(result.errors) > 0
+							}
+							plan, skipped, skippedRules := buildCleanupPlan(report)
+							if err := writeCleanupPlan(plan, c.Args().First()); err != nil {
+								return err
+							}
+							fmt.Printf("Planned %d deletion(s) in %s, skipped %d finding(s) that can't be cleaned up.\n", len(plan.Items), c.Args().First(), skipped)
+							for _, rule := range sortedCounts(skippedRules) {
+								fmt.Printf("Skipped %d %s finding(s), only orphans are cleaned up.\n", skippedRules[rule], ruleLabel(rule))
+							}
+							if partial {
+								return cli.Exit("The validation was incomplete, the plan may miss objects", exitPartial)
+							}
 							return nil
 						},
 					},
 					{
-						Name:    "ing",
-						Aliases: []string{"ingress", "ingresses"},
-						Usage:   "validate ingress(s)",
-						Flags:   flags,
+						Name:      "apply",
+						Usage:     "delete the objects listed in a plan file",
+						ArgsUsage: "<plan-file>",
+						Flags: append(flags,
+							&cli.BoolFlag{
+								Name:        "dry-run",
+								Usage:       "ask the API server to validate the deletions without persisting them",
+								Destination: &dryRun,
+							},
+							&cli.StringFlag{
+								Name:        "backup-dir",
+								Value:       "kube-cleanup-backup",
+								Usage:       "directory the manifests of deleted objects are backed up to",
+								Destination: &backupDir,
+							},
+						),
 						Action: func(c *cli.Context) error {
-							orphans := validateIngresses(kubeconfig, namespace)
-							printReport(orphans, outputMode)
+							if c.NArg() != 1 {
+								return errors.New("Plan file not specified")
+							}
+							plan, err := readCleanupPlan(c.Args().First())
+							if err != nil {
+								return err
+							}
+							api, err := clients().apiClients()
+							if err != nil {
+								return connectionError("Unable to connect to K8s", err)
+							}
+							deleted, refused := applyCleanupPlan(api.dynamic, api.resources, plan, backupDir, dryRun)
+							fmt.Printf("Deleted %d object(s), refused %d.\n", deleted, refused)
+							if refused > 0 {
+								return cli.Exit("", exitPartial)
+							}
 							return nil
 						},
 					},
-					{
-						Name:    "svc",
-						Aliases: []string{"service", "services"},
-						Usage:   "validate service(s)",
-						Flags:   flags,
-						Action: func(c *cli.Context) error {
-							orphans := validateServices(kubeconfig, namespace)
-							printReport(orphans, outputMode)
-							return nil
-						},
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "recreate objects deleted by cleanup from their backups",
+				ArgsUsage: "<backup-dir>",
+				Flags: append(flags,
+					&cli.StringFlag{
+						Name:        "kind",
+						Value:       "",
+						Usage:       "only restore objects of this kind",
+						Destination: &restoreKind,
+					},
+					&cli.StringFlag{
+						Name:        "name",
+						Value:       "",
+						Usage:       "only restore objects with this name",
+						Destination: &restoreName,
 					},
+				),
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("Backup directory not specified")
+					}
+					client, err := clients().dynamicClient()
+					if err != nil {
+						return connectionError("Unable to connect to K8s", err)
+					}
+					restored, failed, err := restoreBackup(client, c.Args().First(), restoreKind, namespace, restoreName)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Restored %d object(s), %d failed.\n", restored, failed)
+					if failed > 0 {
+						return cli.Exit("", exitPartial)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "snapshot",
+				Usage: "capture the cluster state for offline validation",
+				Subcommands: []*cli.Command{
 					{
-						Name:    "dep",
-						Aliases: []string{"deployment", "deployments"},
-						Usage:   "validate deployment(s)",
-						Flags:   flags,
+						Name:      "save",
+						Usage:     "save every kind the validators and the dependency graph use to a compressed archive",
+						ArgsUsage: "<file>",
+						Flags:     flags,
 						Action: func(c *cli.Context) error {
-							orphans := validateDeployments(kubeconfig, namespace)
-							printReport(orphans, outputMode)
+							if c.NArg() != 1 {
+								return errors.New("Snapshot file not specified")
+							}
+							snapshot, err := loadState(context.Background(), clients(), "", "", namespace, appendKinds(requiredKinds(registeredCheckers()), graphKinds))
+							if err != nil {
+								return err
+							}
+							count, err := saveArchive(snapshot, c.Args().First())
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Saved %d object(s) to %s\n", count, c.Args().First())
+							if len(snapshot.errors) > 0 {
+								return cli.Exit(fmt.Sprintf("%d list(s) failed, the snapshot is incomplete", len(snapshot.errors)), exitPartial)
+							}
 							return nil
 						},
 					},
 				},
-
-				Action: func(c *cli.Context) error {
-					//run(kubeconfig, outputMode)
-					fmt.Printf("Running validation...")
-					return nil
-				},
 			},
 		},
 		Action: func(c *cli.Context) error {
@@ -237,221 +822,74 @@ func main() {
 
 }
 
-func getKubernetesClient(kubeconfig string) (*kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		log.Println("Local configuration not found, trying in-cluster configuration.")
-		config, err = rest.InClusterConfig()
+// loadState builds the snapshot the checkers run against: from a snapshot archive, from manifests, or
+// by listing the kinds from the cluster. Kinds the cluster refuses to list are recorded in the snapshot.
+func loadState(ctx context.Context, clients *clientFactory, fromFile string, snapshotFile string, namespace string, kinds []string) (*Snapshot, error) {
+	if snapshotFile != "" {
+		snapshot, err := loadArchive(snapshotFile, namespace)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Unable to read snapshot: %s", err.Error())
 		}
-		inCluster = true
-	}
-	inCluster = false
-
-	if inCluster {
-		log.Printf("Configured to run in in-cluster mode.\n")
-	} else {
-		log.Printf("Configured to run in out-of cluster mode.\n")
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	return clientset, err
-}
-
-func addInventoryViolation(orphans map[string]ResourceInventoryList, namespace string, name string, reason InventoryViolation) {
-	inventoryList, ok := orphans[namespace]
-	if !ok {
-		inventoryList = ResourceInventoryList{Items: make(map[string]InventoryViolation)}
-	}
-	inventoryList.Items[name] = reason
-	orphans[namespace] = inventoryList
-}
-
-func validateIngresses(kubeconfig string, namespace string) map[string]ResourceInventoryList {
-	clientset, err := getKubernetesClient(kubeconfig)
-	if err != nil {
-		betterPanic("Unable to connect to K8s: %s", err.Error())
+		return snapshot, nil
 	}
-
-	ingresses, err := clientset.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
-	if err != nil {
-		betterPanic("Unable to retrieve ingresses: %s", err.Error())
-	}
-
-	orphans := make(map[string]ResourceInventoryList)
-
-	fmt.Printf("Examining ingress rules.\n")
-	bar := pb.StartNew(len(ingresses.Items))
-	for _, ingress := range ingresses.Items {
-		bar.Increment()
-
-		for _, rule := range ingress.Spec.Rules {
-			if rule.HTTP == nil {
-				addInventoryViolation(orphans, ingress.Namespace, ingress.Name, InventoryViolation{Reason: "no HTTP routes in ingress", Kind: "ingress", Name: ingress.Name})
-				continue
-			}
-			for _, path := range rule.HTTP.Paths {
-
-				serviceName := path.Backend.ServiceName
-				servicePort := path.Backend.ServicePort.IntVal
-				service, err := clientset.CoreV1().Services(ingress.Namespace).Get(serviceName, metav1.GetOptions{})
-				if err != nil {
-					addInventoryViolation(orphans, ingress.Namespace, ingress.Name, InventoryViolation{Reason: "references a missing service: " + err.Error(), Kind: "ingress", Reference: ResourceReference{Kind: "service", Name: serviceName}, Name: ingress.Name})
-					continue
-				}
-
-				found := false
-				for _, port := range service.Spec.Ports {
-					if port.Port == servicePort {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					addInventoryViolation(orphans, ingress.Namespace, ingress.Name, InventoryViolation{Reason: fmt.Sprintf("Service doesn't expose ingress port %d", servicePort), Kind: "ingress", Reference: ResourceReference{Kind: "service", Name: serviceName}, Name: ingress.Name})
-					continue
-				}
-			}
+	if fromFile != "" {
+		snapshot, err := loadManifests(fromFile, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read manifests: %s", err.Error())
 		}
+		return snapshot, nil
 	}
-	bar.Finish()
-	return orphans
-}
-
-func validateNamespaces(kubeconfig string) map[string]ResourceInventoryList {
-	orphans := make(map[string]ResourceInventoryList)
 
-	clientset, err := getKubernetesClient(kubeconfig)
+	api, err := clients.apiClients()
 	if err != nil {
-		betterPanic("Unable to connect to K8s: %s", err.Error())
+		return nil, connectionError("Unable to connect to K8s", err)
 	}
-
-	namespaces, err := clientset.CoreV1().Namespaces().List(metav1.ListOptions{})
+	snapshot, err := loadSnapshot(ctx, api, namespace, kinds)
 	if err != nil {
-		betterPanic("Unable to retrieve namespaces: %s", err.Error())
-	}
-
-	bar := pb.StartNew(len(namespaces.Items))
-	for _, namespace := range namespaces.Items {
-		bar.Increment()
-		if namespace.Status.Phase == v1.NamespaceTerminating && contains("kubernetes", namespace.Finalizers) {
-			addInventoryViolation(orphans, namespace.Namespace, namespace.Name, InventoryViolation{Reason: "stuck in termination", Kind: "ingress", Name: namespace.Namespace})
-		}
+		return nil, connectionError("Unable to load the cluster state", err)
 	}
-	bar.Finish()
-
-	return orphans
+	return snapshot, nil
 }
 
-func validateServices(kubeconfig string, namespace string) map[string]ResourceInventoryList {
-	orphans := make(map[string]ResourceInventoryList)
-	clientset, err := getKubernetesClient(kubeconfig)
-	if err != nil {
-		betterPanic("Unable to connect to K8s: %s", err.Error())
+// validate runs the given checkers and returns their merged findings, and with routes, the
+// successful routes of the dependency graph.
+func validate(clients *clientFactory, fromFile string, snapshotFile string, namespace string, checks []Checker, routes bool) (*validationResult, error) {
+	ctx := context.Background()
+	kinds := requiredKinds(checks)
+	if routes {
+		kinds = appendKinds(kinds, graphKinds)
 	}
-
-	services, err := clientset.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	snapshot, err := loadState(ctx, clients, fromFile, snapshotFile, namespace, kinds)
 	if err != nil {
-		betterPanic("Unable to retrieve services: %s", err.Error())
+		return nil, err
 	}
-
-	bar := pb.StartNew(len(services.Items))
-	for _, service := range services.Items {
-		bar.Increment()
-		if "default" == service.Namespace && "kubernetes" == service.Name {
-			continue
-		}
-		// No selector on the service, i.e. calls cannot be routed
-		if len(service.Spec.Selector) == 0 && service.Spec.Type != v1.ServiceTypeExternalName {
-			addInventoryViolation(orphans, service.Namespace, service.Name, InventoryViolation{Reason: "no selector", Kind: "service", Name: service.Name})
-
-			continue
-		}
-
-		if service.Spec.Type == v1.ServiceTypeLoadBalancer {
-			if len(service.Status.LoadBalancer.Ingress) == 0 {
-				addInventoryViolation(orphans, service.Namespace, service.Name, InventoryViolation{Reason: "LoadBalancer service in pending state", Kind: "service", Name: service.Name})
-
-			}
-			continue
-		}
-
-		if service.Spec.Type == v1.ServiceTypeExternalName {
-			if !isd.IsDomain(service.Spec.ExternalName) {
-				addInventoryViolation(orphans, service.Namespace, service.Name, InventoryViolation{Reason: fmt.Sprintf("%s is not a valid CNAME", service.Spec.ExternalName), Kind: "service", Name: service.Name})
-			}
-			continue
-		}
-
-		listOptions := metav1.ListOptions{}
-		listOptions.LabelSelector = labels.SelectorFromSet(service.Spec.Selector).String()
-
-		podList, err := clientset.CoreV1().Pods(namespace).List(listOptions)
-
+	result := runCheckers(ctx, snapshot, checks)
+	if routes {
+		graph, err := snapshot.Graph()
 		if err != nil {
-			addInventoryViolation(orphans, service.Namespace, service.Name, InventoryViolation{Reason: "backing service references no workloads: " + err.Error(), Kind: "service", Name: service.Name})
-			continue
-		}
-
-		if len(podList.Items) == 0 {
-			addInventoryViolation(orphans, service.Namespace, service.Name, InventoryViolation{Reason: "backing workload contains no pods", Kind: "service", Reference: ResourceReference{Kind: "pod", LabelSelector: listOptions.LabelSelector}, Name: service.Name})
-
-			continue
+			return nil, err
 		}
-
+		result.routes = graph.Routes()
 	}
-	bar.Finish()
-	return orphans
+	return result, nil
 }
 
-func validateDeployments(kubeconfig string, namespace string) map[string]ResourceInventoryList {
-	orphans := make(map[string]ResourceInventoryList)
-	clientset, err := getKubernetesClient(kubeconfig)
-	if err != nil {
-		betterPanic("Unable to connect to K8s: %s", err.Error())
+func addInventoryViolation(orphans map[string]ResourceInventoryList, namespace string, name string, reason InventoryViolation) {
+	inventoryList, ok := orphans[namespace]
+	if !ok {
+		inventoryList = ResourceInventoryList{Items: make(map[string]InventoryViolation)}
 	}
-
-	deployments, err := clientset.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
-	if err != nil {
-		betterPanic("Unable to retrieve deployments: %s", err.Error())
+	// Different kinds may share a name and an object may break several rules, so key the items by
+	// kind and rule as well.
+	key := name
+	if reason.Kind != "" {
+		key = reason.Kind + "/" + name
 	}
-
-	bar := pb.StartNew(len(deployments.Items))
-	for _, deployment := range deployments.Items {
-		bar.Increment()
-
-		// No selector on the service, i.e. calls cannot be routed
-		if deployment.Status.Replicas == 0 {
-			addInventoryViolation(orphans, deployment.Namespace, deployment.Name, InventoryViolation{Reason: "deployment scaled down to 0 replicas", Kind: "deployment", Name: deployment.Name})
-			continue
-		}
-
-		if len(deployment.Labels) == 0 {
-			addInventoryViolation(orphans, deployment.Namespace, deployment.Name, InventoryViolation{Reason: "no labels on deployment", Kind: "deployment", Name: deployment.Name})
-			continue
-		}
-
-		for _, condition := range deployment.Status.Conditions {
-			if condition.Type == v1apps.DeploymentAvailable && condition.Status == "False" && condition.Reason == "MinimumReplicasUnavailable" {
-				addInventoryViolation(orphans, deployment.Namespace, deployment.Name, InventoryViolation{Reason: "minimum replicas unavailable, could be temporary", Kind: "deployment", Name: deployment.Name})
-				continue
-			}
-
-			if condition.Type == v1apps.DeploymentProgressing && condition.Status == "False" && condition.Reason == "ProgressDeadlineExceeded" {
-				fmt.Printf("%v\n", condition)
-				addInventoryViolation(orphans, deployment.Namespace, deployment.Name, InventoryViolation{Reason: condition.Message, Kind: "deployment", Name: deployment.Name})
-				continue
-			}
-		}
-		if deployment.Status.ReadyReplicas == 0 {
-			addInventoryViolation(orphans, deployment.Namespace, deployment.Name, InventoryViolation{Reason: "no replicas are ready", Kind: "deployment", Name: deployment.Name})
-			continue
-		}
+	if reason.Rule != "" {
+		key += "/" + reason.Rule
 	}
-	bar.Finish()
-	return orphans
+	inventoryList.Items[key] = reason
+	orphans[namespace] = inventoryList
 }
 
 // func run(kubeconfig string, outputMode string) {
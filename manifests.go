@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// loadManifests builds a snapshot from a manifest file or a directory of manifests. Both plain
+// (multi-document) manifests and List dumps produced by `kubectl get ... -o yaml` are understood.
+func loadManifests(path string, namespace string) (*Snapshot, error) {
+	snapshot := newSnapshot(namespace)
+	skipped := 0
+
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !contains(strings.ToLower(filepath.Ext(file)), manifestExtensions) {
+			return nil
+		}
+		objects, err := readManifestFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		for _, obj := range objects {
+			if !snapshot.addManifest(obj) {
+				skipped++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.addTemplatePods()
+	if skipped > 0 {
+		log.Printf("Skipped %d manifest(s) of kinds the checkers don't use.\n", skipped)
+	}
+	return snapshot, nil
+}
+
+func readManifestFile(file string) ([]runtime.Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readManifests(f)
+}
+
+func readManifests(reader io.Reader) ([]runtime.Object, error) {
+	objects := make([]runtime.Object, 0)
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		decoded, err := decodeManifest(raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+// decodeManifest decodes a single document, flattening lists into their items.
+func decodeManifest(data []byte) ([]runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) {
+			return decodeUnstructured(data)
+		}
+		return nil, err
+	}
+	if !meta.IsListType(obj) {
+		return []runtime.Object{obj}, nil
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		if unknown, ok := item.(*runtime.Unknown); ok {
+			decoded, err := decodeManifest(unknown.Raw)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+			continue
+		}
+		objects = append(objects, item)
+	}
+	return objects, nil
+}
+
+// decodeUnstructured keeps the versioned kinds the client doesn't know, such as networking.k8s.io/v1
+// ingresses, unstructured. Custom resources and other unknown kinds are of no interest to the checkers.
+func decodeUnstructured(data []byte) ([]runtime.Object, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	gvk := obj.GroupVersionKind()
+	for kind, candidates := range versionedKinds {
+		for _, candidate := range candidates {
+			if candidate.GroupVersion() == gvk.GroupVersion() && strings.EqualFold(kind, gvk.Kind) {
+				return []runtime.Object{obj}, nil
+			}
+		}
+	}
+	return []runtime.Object{}, nil
+}
+
+// toUnstructured converts a typed object, keeping its apiVersion and kind.
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	converted := &unstructured.Unstructured{Object: content}
+	converted.SetGroupVersionKind(gvks[0])
+	return converted, nil
+}
+
+// convertObject converts between representations that share the same JSON schema, e.g. an
+// unstructured ingress and an Ingress.
+func convertObject(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// addTemplatePods stands in the pod templates of workloads for pods when the manifests contain no
+// pods at all, as is the case for rendered charts, so selector checks still have something to match.
+// The template pods are owned by their workload, which links them in the dependency graph.
+func (s *Snapshot) addTemplatePods() {
+	if len(s.objects(kindPod)) > 0 {
+		return
+	}
+	for _, deployment := range s.Deployments() {
+		s.addTemplatePod(deployment, "Deployment", deployment.Spec.Template)
+	}
+	for _, daemonSet := range s.DaemonSets() {
+		s.addTemplatePod(daemonSet, "DaemonSet", daemonSet.Spec.Template)
+	}
+	for _, statefulSet := range s.StatefulSets() {
+		s.addTemplatePod(statefulSet, "StatefulSet", statefulSet.Spec.Template)
+	}
+}
+
+func (s *Snapshot) addTemplatePod(owner metav1.Object, kind string, template v1.PodTemplateSpec) {
+	controller := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            owner.GetName() + "-template",
+			Namespace:       owner.GetNamespace(),
+			Labels:          template.Labels,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: owner.GetName(), Controller: &controller}},
+		},
+		Spec: template.Spec,
+	}
+	s.indexer(kindPod).Add(pod)
+}
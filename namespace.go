@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"github.com/cheggaaa/pb"
+	v1 "k8s.io/api/core/v1"
+)
+
+type namespaceChecker struct{}
+
+func init() {
+	registerChecker(namespaceChecker{}, "namespace", "namespaces")
+}
+
+func (namespaceChecker) Name() string        { return "ns" }
+func (namespaceChecker) Description() string { return "validate namespace(s)" }
+func (namespaceChecker) Kinds() []string     { return []string{kindNamespace} }
+
+func (namespaceChecker) Check(ctx context.Context, snapshot *Snapshot) ([]InventoryViolation, error) {
+	violations := make([]InventoryViolation, 0)
+	namespaces := snapshot.Namespaces()
+
+	bar := pb.StartNew(len(namespaces))
+	for _, namespace := range namespaces {
+		bar.Increment()
+		if snapshot.Namespace != "" && snapshot.Namespace != namespace.Name {
+			continue
+		}
+		if namespace.Status.Phase == v1.NamespaceTerminating && hasFinalizer(namespace.Spec.Finalizers, v1.FinalizerKubernetes) {
+			violations = append(violations, InventoryViolation{Rule: "NS001", Reason: "stuck in termination", Kind: kindNamespace, Name: namespace.Name, Namespace: namespace.Name})
+		}
+	}
+	bar.Finish()
+
+	return violations, nil
+}
+
+// hasFinalizer tells whether the namespace spec lists the finalizer. The kubernetes finalizer lives in
+// spec.finalizers, not in metadata.finalizers, and is only removed through the finalize subresource.
+func hasFinalizer(finalizers []v1.FinalizerName, finalizer v1.FinalizerName) bool {
+	for _, name := range finalizers {
+		if name == finalizer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// sortedReport orders namespaces and their items so generated output is stable between runs.
+func sortedReport(namespaceList NamespaceList) NamespaceList {
+	sorted := namespaceList
+	sorted.Namespaces = sortedNamespaces(namespaceList.Namespaces)
+	sorted.Suppressed = sortedNamespaces(namespaceList.Suppressed)
+	if namespaceList.Routes != nil {
+		sorted.Routes = sortedRoutes(namespaceList.Routes)
+	}
+	return sorted
+}
+
+func sortedNamespaces(namespaces []Namespace) []Namespace {
+	if namespaces == nil {
+		return nil
+	}
+	sorted := make([]Namespace, len(namespaces))
+	copy(sorted, namespaces)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Cluster != sorted[j].Cluster {
+			return sorted[i].Cluster < sorted[j].Cluster
+		}
+		return sorted[i].Namespace < sorted[j].Namespace
+	})
+	for n := range sorted {
+		items := make([]InventoryViolation, len(sorted[n].Items))
+		copy(items, sorted[n].Items)
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Severity != items[j].Severity {
+				return severityRank(items[i].Severity) > severityRank(items[j].Severity)
+			}
+			if items[i].Kind != items[j].Kind {
+				return items[i].Kind < items[j].Kind
+			}
+			if items[i].Name != items[j].Name {
+				return items[i].Name < items[j].Name
+			}
+			return items[i].Reason < items[j].Reason
+		})
+		sorted[n].Items = items
+	}
+	return sorted
+}
+
+// sortedRoutes orders the routes by cluster and namespace, the service routes first, then the ingress
+// routes by ingress, host and path.
+func sortedRoutes(routes []Route) []Route {
+	sorted := make([]Route, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		for _, pair := range [][2]string{{a.Cluster, b.Cluster}, {a.Namespace, b.Namespace}, {a.Ingress, b.Ingress}, {a.Host, b.Host}, {a.Path, b.Path}, {a.Service, b.Service}} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+	return sorted
+}
+
+// routeSource names where the route starts, the ingress with its host and path, or "-" for services.
+func routeSource(route Route) string {
+	if route.Ingress == "" {
+		return "-"
+	}
+	source := "ingress/" + route.Ingress
+	if location := route.Host + route.Path; location != "" {
+		source += " " + location
+	}
+	return source
+}
+
+func routeService(route Route) string {
+	if route.Port == "" {
+		return route.Service
+	}
+	return route.Service + ":" + route.Port
+}
+
+// routeTarget names where the route ends: the external name, or the workloads and their ready pods.
+func routeTarget(route Route) string {
+	if route.ExternalName != "" {
+		return route.ExternalName
+	}
+	return fmt.Sprintf("%s (%d/%d pods ready)", strings.Join(route.Workloads, ", "), route.ReadyPods, route.Pods)
+}
+
+// kubectlCommand returns the command that resolves the violation. Stuck namespaces get the finalizers
+// of their spec cleared through the finalize subresource, the only way to change them, which needs
+// jq. Everything else is deleted. Violations of a multi-cluster run name their context.
+func kubectlCommand(namespace Namespace, item InventoryViolation) string {
+	kubectl := "kubectl"
+	if namespace.Cluster != "" {
+		kubectl += " --context " + namespace.Cluster
+	}
+	if item.Kind == kindNamespace {
+		return fmt.Sprintf("%s get namespace %s -o json | jq '.spec.finalizers=[]' | %s replace --raw /api/v1/namespaces/%s/finalize -f -", kubectl, item.Name, kubectl, item.Name)
+	}
+	return fmt.Sprintf("%s delete %s %s -n %s", kubectl, item.Kind, item.Name, namespace.Namespace)
+}
+
+// printKubectlScript writes a reviewable shell script with a command for every violation, each
+// preceded by the reason it was reported.
+func printKubectlScript(w io.Writer, namespaceList NamespaceList) {
+	fmt.Fprintf(w, "#!/bin/sh\n")
+	fmt.Fprintf(w, "# Generated by kube-cleanup. Review every command before running this script.\n")
+	for _, namespace := range sortedReport(namespaceList).Namespaces {
+		fmt.Fprintf(w, "\n# Namespace: %s\n", namespaceLabel(namespace.Cluster, namespace.Namespace))
+		commands := make(map[string]bool)
+		for _, item := range namespace.Items {
+			command := kubectlCommand(namespace, item)
+			fmt.Fprintf(w, "# %s %s: %s\n", item.Kind, item.Name, strings.Join(strings.Fields(item.Reason), " "))
+			if item.Rule != "" {
+				fmt.Fprintf(w, "# rule %s, severity %s\n", ruleText(item), item.Severity)
+			}
+			if commands[command] {
+				fmt.Fprintf(w, "# (already listed above)\n")
+				continue
+			}
+			commands[command] = true
+			fmt.Fprintf(w, "%s\n", command)
+		}
+	}
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// stdoutIsTerminal tells whether a human is likely looking at the output.
+func stdoutIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+}
+
+// outputModes are the formats the validation report is printed in.
+var outputModes = []string{"text", "yaml", "json", "kubectl"}
+
+// defaultOutputMode picks text when a human is likely looking at the output and yaml otherwise.
+func defaultOutputMode(outputMode string) string {
+	if outputMode != "" {
+		return outputMode
+	}
+	if stdoutIsTerminal() {
+		return "text"
+	}
+	return "yaml"
+}
+
+func colorize(text string, color string, enabled bool) string {
+	if !enabled || color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func referenceText(reference ResourceReference) string {
+	switch {
+	case reference.Name != "":
+		return reference.Kind + "/" + reference.Name
+	case reference.LabelSelector != "":
+		return reference.Kind + " " + reference.LabelSelector
+	}
+	return "-"
+}
+
+func ruleText(item InventoryViolation) string {
+	if item.RuleName == "" {
+		return item.Rule
+	}
+	return item.Rule + " " + item.RuleName
+}
+
+func severityColor(severity string) string {
+	switch severity {
+	case severityCritical:
+		return colorBold + colorRed
+	case severityError:
+		return colorRed
+	case severityWarning:
+		return colorYellow
+	}
+	return colorDim
+}
+
+// printTable prints aligned columns. Widths are computed on the plain text so colors don't
+// throw the alignment off; the last column is never padded. colors returns the colors of the
+// cells of the row at the given index.
+func printTable(w io.Writer, header []string, rows [][]string, colors func(row int) []string, color bool) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	printRow := func(row []string, rowColors []string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-len(cell))
+			}
+			cells[i] = colorize(cell, rowColors[i], color)
+		}
+		fmt.Fprintf(w, "%s\n", strings.TrimRight(strings.Join(cells, "   "), " "))
+	}
+
+	headerColors := make([]string, len(header))
+	for i := range headerColors {
+		headerColors[i] = colorBold
+	}
+	printRow(header, headerColors)
+	for i, row := range rows {
+		printRow(row, colors(i))
+	}
+}
+
+// sortedCounts returns the keys of the counts ordered by name.
+func sortedCounts(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printTextReport prints a table of violations per namespace, followed by validator timings and totals.
+func printTextReport(w io.Writer, namespaceList NamespaceList, color bool) {
+	total := 0
+	for _, namespace := range sortedReport(namespaceList).Namespaces {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Namespace: "+namespaceLabel(namespace.Cluster, namespace.Namespace), colorBold, color))
+		rows := make([][]string, 0, len(namespace.Items))
+		for _, item := range namespace.Items {
+			rows = append(rows, []string{item.Severity, ruleText(item), item.Kind, item.Name, referenceText(item.Reference), strings.Join(strings.Fields(item.Reason), " ")})
+		}
+		items := namespace.Items
+		printTable(w, []string{"SEVERITY", "RULE", "KIND", "NAME", "REFERENCE", "REASON"}, rows, func(row int) []string {
+			return []string{severityColor(items[row].Severity), colorDim, colorCyan, "", colorDim, ""}
+		}, color)
+		total += len(namespace.Items)
+	}
+
+	if len(namespaceList.Routes) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Routes", colorBold, color))
+		rows := make([][]string, 0, len(namespaceList.Routes))
+		for _, route := range sortedRoutes(namespaceList.Routes) {
+			rows = append(rows, []string{namespaceLabel(route.Cluster, route.Namespace), routeSource(route), routeService(route), routeTarget(route)})
+		}
+		printTable(w, []string{"NAMESPACE", "FROM", "SERVICE", "TO"}, rows, func(row int) []string {
+			return []string{"", colorCyan, "", colorGreen}
+		}, color)
+	}
+
+	if len(namespaceList.Fixed) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Fixed since the baseline", colorBold, color))
+		rows := make([][]string, 0, len(namespaceList.Fixed))
+		for _, entry := range namespaceList.Fixed {
+			rows = append(rows, []string{entry.Rule, entry.Kind, namespaceLabel(entry.Cluster, entry.Namespace), entry.Name})
+		}
+		printTable(w, []string{"RULE", "KIND", "NAMESPACE", "NAME"}, rows, func(row int) []string {
+			return []string{colorDim, colorCyan, "", ""}
+		}, color)
+	}
+
+	if len(namespaceList.Timings) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Validators", colorBold, color))
+		rows := make([][]string, 0, len(namespaceList.Timings))
+		for _, timing := range namespaceList.Timings {
+			rows = append(rows, []string{namespaceLabel(timing.Cluster, timing.Validator), fmt.Sprintf("%d", timing.Violations), fmt.Sprintf("%d", timing.Suppressed), timing.Duration})
+		}
+		printTable(w, []string{"VALIDATOR", "VIOLATIONS", "SUPPRESSED", "DURATION"}, rows, func(row int) []string {
+			return []string{colorCyan, "", colorDim, colorDim}
+		}, color)
+	}
+
+	if namespaceList.Summary != nil && namespaceList.Summary.Total > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Summary", colorBold, color))
+		rows := make([][]string, 0)
+		for _, namespace := range sortedCounts(namespaceList.Summary.Namespaces) {
+			rows = append(rows, []string{"namespace", namespace, fmt.Sprintf("%d", namespaceList.Summary.Namespaces[namespace])})
+		}
+		for _, kind := range sortedCounts(namespaceList.Summary.Kinds) {
+			rows = append(rows, []string{"kind", kind, fmt.Sprintf("%d", namespaceList.Summary.Kinds[kind])})
+		}
+		for _, severity := range severities {
+			if count, ok := namespaceList.Summary.Severities[severity]; ok {
+				rows = append(rows, []string{"severity", severity, fmt.Sprintf("%d", count)})
+			}
+		}
+		printTable(w, []string{"BY", "VALUE", "VIOLATIONS"}, rows, func(row int) []string {
+			return []string{colorDim, colorCyan, ""}
+		}, color)
+	}
+
+	if len(namespaceList.Clusters) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Clusters", colorBold, color))
+		rows := make([][]string, 0, len(namespaceList.Clusters))
+		for _, cluster := range namespaceList.Clusters {
+			status := "complete"
+			if cluster.Failed {
+				status = "failed"
+			} else if cluster.Errors > 0 {
+				status = "partial"
+			}
+			rows = append(rows, []string{cluster.Cluster, status, fmt.Sprintf("%d", cluster.Violations), fmt.Sprintf("%d", cluster.Suppressed), fmt.Sprintf("%d", cluster.Baselined), fmt.Sprintf("%d", cluster.Errors)})
+		}
+		clusters := namespaceList.Clusters
+		printTable(w, []string{"CLUSTER", "STATUS", "VIOLATIONS", "SUPPRESSED", "BASELINED", "ERRORS"}, rows, func(row int) []string {
+			statusColor := colorGreen
+			if clusters[row].Failed || clusters[row].Errors > 0 {
+				statusColor = colorRed
+			}
+			return []string{colorCyan, statusColor, "", colorDim, colorDim, ""}
+		}, color)
+	}
+
+	if len(namespaceList.Errors) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Errors, the results are incomplete", colorBold, color))
+		printTable(w, []string{"FAILED", "NAMESPACE", "AFFECTS", "MESSAGE"}, errorRows(namespaceList.Errors), func(row int) []string {
+			return []string{colorRed, "", colorCyan, colorDim}
+		}, color)
+	}
+	if len(namespaceList.Warnings) > 0 {
+		fmt.Fprintf(w, "\n%s\n\n", colorize("Warnings, suppression annotations of namespaces were not read", colorBold, color))
+		printTable(w, []string{"FAILED", "NAMESPACE", "AFFECTS", "MESSAGE"}, errorRows(namespaceList.Warnings), func(row int) []string {
+			return []string{colorYellow, "", colorCyan, colorDim}
+		}, color)
+	}
+
+	suppressed := 0
+	for _, namespace := range namespaceList.Suppressed {
+		suppressed += len(namespace.Items)
+	}
+
+	totalColor := colorRed
+	if total == 0 {
+		totalColor = ""
+	}
+	footer := fmt.Sprintf("Total: %d violation(s) in %d namespace(s)", total, len(namespaceList.Namespaces))
+	if suppressed > 0 {
+		footer += fmt.Sprintf(", %d suppressed by annotations", suppressed)
+	}
+	if namespaceList.Summary != nil && namespaceList.Summary.Baselined > 0 {
+		footer += fmt.Sprintf(", %d hidden by the baseline", namespaceList.Summary.Baselined)
+	}
+	if len(namespaceList.Routes) > 0 {
+		footer += fmt.Sprintf(", %d successful route(s)", len(namespaceList.Routes))
+	}
+	if len(namespaceList.Errors) > 0 {
+		footer += fmt.Sprintf(", %d error(s)", len(namespaceList.Errors))
+	}
+	if len(namespaceList.Warnings) > 0 {
+		footer += fmt.Sprintf(", %d warning(s)", len(namespaceList.Warnings))
+	}
+	fmt.Fprintf(w, "\n%s\n", colorize(footer, totalColor, color))
+}
+
+// errorRows describes what failed, where and which validators it affects.
+func errorRows(reportErrors []ReportError) [][]string {
+	rows := make([][]string, 0, len(reportErrors))
+	for _, reportError := range reportErrors {
+		what := strings.TrimSpace(reportError.Verb + " " + reportError.Resource)
+		if reportError.Validator != "" {
+			what = "validator " + reportError.Validator
+		}
+		if what == "" {
+			what = "cluster"
+		}
+		if reportError.Cluster != "" {
+			what = reportError.Cluster + ": " + what
+		}
+		rows = append(rows, []string{what, reportError.Namespace, strings.Join(reportError.Validators, ","), reportError.Message})
+	}
+	return rows
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ReportError records something the run couldn't look at, so a partial report says what is missing.
+// Failed API requests carry the verb and resource that were refused, failed validators their name.
+type ReportError struct {
+	Cluster   string `json:",omitempty" yaml:",omitempty"`
+	Verb      string `json:",omitempty" yaml:",omitempty"`
+	Resource  string `json:",omitempty" yaml:",omitempty"`
+	Namespace string `json:",omitempty" yaml:",omitempty"`
+	Validator string `json:",omitempty" yaml:",omitempty"`
+	Reason    string `json:",omitempty" yaml:",omitempty"`
+	Message   string `json:",omitempty" yaml:",omitempty"`
+	// Validators lists the validators whose findings are incomplete because of the error.
+	Validators []string `json:",omitempty" yaml:",omitempty"`
+}
+
+// resourceName formats the resource the way RBAC rules name it, e.g. deployments.apps.
+func resourceName(resource schema.GroupVersionResource) string {
+	if resource.Group == "" {
+		return resource.Resource
+	}
+	return resource.Resource + "." + resource.Group
+}
+
+// apiStatus returns the status of an error returned by the API server, or false for errors that
+// never reached it, such as connection failures.
+func apiStatus(err error) (apierrors.APIStatus, bool) {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status, true
+	}
+	return nil, false
+}
+
+// recordFailure remembers that the kind couldn't be listed in the namespace, or anywhere if the
+// namespace is blank.
+func (s *Snapshot) recordFailure(verb string, kind string, namespace string, err error) {
+	reportError := ReportError{Verb: verb, Resource: resourceName(s.resource(kind)), Namespace: namespace, Message: err.Error()}
+	if status, ok := apiStatus(err); ok {
+		reportError.Reason = string(status.Status().Reason)
+		reportError.Message = status.Status().Message
+	}
+	where := "any namespace"
+	if namespace != "" {
+		where = "namespace " + namespace
+	}
+	log.Printf("Unable to %s %s in %s: %s\n", verb, reportError.Resource, where, reportError.Message)
+
+	s.errors = append(s.errors, reportError)
+	if s.failed[kind] == nil {
+		s.failed[kind] = make(map[string]bool)
+	}
+	s.failed[kind][namespace] = true
+}
+
+// incomplete tells whether objects of the kind in the namespace may be missing from the snapshot.
+func (s *Snapshot) incomplete(kind string, namespace string) bool {
+	return s.failed[kind][""] || s.failed[kind][namespace]
+}
+
+// reportErrors returns the failures of the snapshot, naming the checkers each of them affects. Failures
+// to read namespaces no checker reads are returned as warnings: they only cost the suppression
+// annotations of the namespaces, the findings are still complete.
+func (s *Snapshot) reportErrors(checks []Checker) ([]ReportError, []ReportError) {
+	failures := make([]ReportError, 0, len(s.errors))
+	warnings := make([]ReportError, 0)
+	for _, reportError := range s.errors {
+		for _, checker := range checks {
+			for _, kind := range checker.Kinds() {
+				if resourceName(s.resource(kind)) == reportError.Resource {
+					reportError.Validators = append(reportError.Validators, checker.Name())
+					break
+				}
+			}
+		}
+		if len(reportError.Validators) == 0 && reportError.Resource == resourceName(s.resource(kindNamespace)) {
+			warnings = append(warnings, reportError)
+			continue
+		}
+		failures = append(failures, reportError)
+	}
+	return failures, warnings
+}
+
+// checkerError records a validator that failed.
+func checkerError(checker Checker, err error) ReportError {
+	return ReportError{Validator: checker.Name(), Message: fmt.Sprintf("validation failed: %s", err.Error())}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// preflightVerbs are the columns of the permission matrix.
+var preflightVerbs = []string{"list", "get", "delete", "update"}
+
+// preflightRoleName names the roles generated for the missing permissions.
+const preflightRoleName = "kube-cleanup"
+
+// preflightRow is a kind, or a subresource of it, a check needs and the verbs it needs on it.
+type preflightRow struct {
+	check       string
+	kind        string
+	subresource string
+	verbs       []string
+}
+
+// preflightRows lists the permissions the checkers need. Validators only list, every kind is read
+// once into the snapshot; namespaces are always read for their suppression annotations, only the
+// selected one is got if there is one. Cleanup gets and deletes the objects it cleans up, and the
+// kubectl output gets stuck namespaces and updates their finalize subresource. The route report lists
+// every kind of the dependency graph.
+// Kinds the cluster doesn't serve need no permissions.
+func preflightRows(checks []Checker, cleanup bool, routes bool, resources map[string]schema.GroupVersionResource, namespace string) []preflightRow {
+	readNamespaces := "list"
+	if namespace != "" {
+		readNamespaces = "get"
+	}
+	rows := []preflightRow{{check: "suppressions", kind: kindNamespace, verbs: []string{readNamespaces}}}
+	for _, checker := range checks {
+		for _, kind := range checker.Kinds() {
+			if _, served := resources[kind]; !served {
+				continue
+			}
+			if kind == kindNamespace {
+				rows = append(rows, preflightRow{check: checker.Name(), kind: kind, verbs: []string{readNamespaces}})
+				continue
+			}
+			rows = append(rows, preflightRow{check: checker.Name(), kind: kind, verbs: []string{"list"}})
+		}
+	}
+	if routes {
+		for _, kind := range graphKinds {
+			if _, served := resources[kind]; served {
+				rows = append(rows, preflightRow{check: "routes", kind: kind, verbs: []string{"list"}})
+			}
+		}
+	}
+	if cleanup {
+		for _, kind := range deletableKinds {
+			if _, served := resources[kind]; served {
+				rows = append(rows, preflightRow{check: "cleanup", kind: kind, verbs: []string{"get", "delete"}})
+			}
+		}
+		rows = append(rows, preflightRow{check: "cleanup", kind: kindNamespace, verbs: []string{"get"}})
+		rows = append(rows, preflightRow{check: "cleanup", kind: kindNamespace, subresource: "finalize", verbs: []string{"update"}})
+	}
+	return rows
+}
+
+// scopeOf returns the namespace a permission on the kind has to be granted in. Ingress classes are
+// cluster-scoped, so they are always checked cluster-wide. Permissions on the selected namespace
+// itself can be granted in it.
+func scopeOf(kind string, namespace string) string {
+	if kind == kindIngressClass {
+		return ""
+	}
+	return namespace
+}
+
+type permission struct {
+	verb        string
+	kind        string
+	subresource string
+}
+
+// rowResource names the resource of the row the way RBAC rules do, e.g. namespaces/finalize.
+func rowResource(row preflightRow, resources map[string]schema.GroupVersionResource) string {
+	if row.subresource == "" {
+		return resourceName(resources[row.kind])
+	}
+	resource := resources[row.kind]
+	resource.Resource += "/" + row.subresource
+	return resourceName(resource)
+}
+
+// checkPermissions asks the API server, with a SelfSubjectAccessReview per permission, which of the
+// permissions the rows need the current credentials have in the namespace, or cluster-wide if blank.
+func checkPermissions(clientset kubernetes.Interface, resources map[string]schema.GroupVersionResource, rows []preflightRow, namespace string) (map[permission]bool, error) {
+	allowed := make(map[permission]bool)
+	for _, row := range rows {
+		for _, verb := range row.verbs {
+			key := permission{verb: verb, kind: row.kind, subresource: row.subresource}
+			if _, checked := allowed[key]; checked {
+				continue
+			}
+			resource := resources[row.kind]
+			review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace:   scopeOf(row.kind, namespace),
+						Verb:        verb,
+						Group:       resource.Group,
+						Resource:    resource.Resource,
+						Subresource: row.subresource,
+					},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			allowed[key] = review.Status.Allowed
+		}
+	}
+	return allowed, nil
+}
+
+// printPermissionMatrix prints a row per check and kind with the state of every verb: yes, no or
+// "-" when the check doesn't need it. It returns the number of missing permissions.
+func printPermissionMatrix(w io.Writer, rows []preflightRow, resources map[string]schema.GroupVersionResource, allowed map[permission]bool, color bool) int {
+	missing := make(map[permission]bool)
+	cells := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		cell := []string{row.check, rowResource(row, resources)}
+		for _, verb := range preflightVerbs {
+			key := permission{verb: verb, kind: row.kind, subresource: row.subresource}
+			switch {
+			case !contains(verb, row.verbs):
+				cell = append(cell, "-")
+			case allowed[key]:
+				cell = append(cell, "yes")
+			default:
+				cell = append(cell, "no")
+				missing[key] = true
+			}
+		}
+		cells = append(cells, cell)
+	}
+
+	header := []string{"CHECK", "RESOURCE"}
+	for _, verb := range preflightVerbs {
+		header = append(header, strings.ToUpper(verb))
+	}
+	printTable(w, header, cells, func(row int) []string {
+		colors := []string{colorCyan, ""}
+		for _, cell := range cells[row][2:] {
+			switch cell {
+			case "yes":
+				colors = append(colors, colorGreen)
+			case "no":
+				colors = append(colors, colorRed)
+			default:
+				colors = append(colors, colorDim)
+			}
+		}
+		return colors
+	}, color)
+	return len(missing)
+}
+
+// missingRules turns the permissions that aren't allowed into one policy rule per resource, split
+// into the rules to grant in the namespace and the ones to grant cluster-wide.
+func missingRules(rows []preflightRow, resources map[string]schema.GroupVersionResource, allowed map[permission]bool, namespace string) (namespaced []rbacv1.PolicyRule, clusterWide []rbacv1.PolicyRule) {
+	verbs := make(map[string][]string)
+	named := make(map[string]preflightRow)
+	names := make([]string, 0)
+	for _, row := range rows {
+		name := rowResource(row, resources)
+		for _, verb := range row.verbs {
+			if allowed[permission{verb: verb, kind: row.kind, subresource: row.subresource}] || contains(verb, verbs[name]) {
+				continue
+			}
+			if _, ok := verbs[name]; !ok {
+				names = append(names, name)
+				named[name] = row
+			}
+			verbs[name] = append(verbs[name], verb)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		row := named[name]
+		resource := resources[row.kind]
+		if row.subresource != "" {
+			resource.Resource += "/" + row.subresource
+		}
+		sort.Strings(verbs[name])
+		rule := rbacv1.PolicyRule{APIGroups: []string{resource.Group}, Resources: []string{resource.Resource}, Verbs: verbs[name]}
+		if scopeOf(row.kind, namespace) == "" {
+			clusterWide = append(clusterWide, rule)
+		} else {
+			namespaced = append(namespaced, rule)
+		}
+	}
+	return namespaced, clusterWide
+}
+
+// writeMissingRoles writes a Role for the namespace and a ClusterRole granting exactly the missing
+// permissions, leaving out the ones that would be empty.
+func writeMissingRoles(w io.Writer, namespaced []rbacv1.PolicyRule, clusterWide []rbacv1.PolicyRule, namespace string) error {
+	objects := make([]interface{}, 0, 2)
+	if len(clusterWide) > 0 {
+		objects = append(objects, &rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: preflightRoleName},
+			Rules:      clusterWide,
+		})
+	}
+	if len(namespaced) > 0 {
+		objects = append(objects, &rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: preflightRoleName, Namespace: namespace},
+			Rules:      namespaced,
+		})
+	}
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n%s", data)
+	}
+	return nil
+}
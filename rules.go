@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityError    = "error"
+	severityCritical = "critical"
+)
+
+// severities in increasing order of urgency.
+var severities = []string{severityInfo, severityWarning, severityError, severityCritical}
+
+const (
+	categoryOrphan           = "orphan"
+	categoryMisconfiguration = "misconfiguration"
+	categoryDegraded         = "degraded"
+)
+
+// Rule describes a single kind of finding. Rule IDs are stable, so suppressions, dashboards and
+// alerts can be written against them.
+type Rule struct {
+	ID       string
+	Name     string
+	Severity string
+	Category string
+	// Checker is the name of the checker reporting the rule.
+	Checker string
+}
+
+var rules = make(map[string]Rule)
+
+func registerRule(rule Rule) {
+	if _, ok := rules[rule.ID]; ok {
+		panic(fmt.Sprintf("rule %s is already registered", rule.ID))
+	}
+	if severityRank(rule.Severity) < 0 {
+		panic(fmt.Sprintf("rule %s has an unknown severity %s", rule.ID, rule.Severity))
+	}
+	rules[rule.ID] = rule
+}
+
+func init() {
+	for _, rule := range []Rule{
+		{ID: "NS001", Name: "stuck-terminating", Severity: severityError, Category: categoryDegraded, Checker: "ns"},
+		{ID: "ING001", Name: "missing-backend-service", Severity: severityError, Category: categoryMisconfiguration, Checker: "ing"},
+		{ID: "ING002", Name: "no-http-routes", Severity: severityWarning, Category: categoryMisconfiguration, Checker: "ing"},
+		{ID: "ING003", Name: "backend-port-not-exposed", Severity: severityError, Category: categoryMisconfiguration, Checker: "ing"},
+		{ID: "ING004", Name: "missing-ingress-class", Severity: severityError, Category: categoryMisconfiguration, Checker: "ing"},
+		{ID: "ING005", Name: "deprecated-class-annotation", Severity: severityWarning, Category: categoryMisconfiguration, Checker: "ing"},
+		{ID: "ING006", Name: "no-working-backend", Severity: severityError, Category: categoryOrphan, Checker: "ing"},
+		{ID: "SVC001", Name: "no-selector", Severity: severityWarning, Category: categoryMisconfiguration, Checker: "svc"},
+		{ID: "SVC002", Name: "load-balancer-pending", Severity: severityWarning, Category: categoryDegraded, Checker: "svc"},
+		{ID: "SVC003", Name: "invalid-external-name", Severity: severityError, Category: categoryMisconfiguration, Checker: "svc"},
+		{ID: "SVC004", Name: "pod-lookup-failed", Severity: severityError, Category: categoryDegraded, Checker: "svc"},
+		{ID: "SVC005", Name: "no-matching-pods", Severity: severityError, Category: categoryOrphan, Checker: "svc"},
+		{ID: "SVC006", Name: "target-port-not-declared", Severity: severityWarning, Category: categoryMisconfiguration, Checker: "svc"},
+		{ID: "SVC007", Name: "named-target-port-unresolved", Severity: severityError, Category: categoryMisconfiguration, Checker: "svc"},
+		{ID: "SVC008", Name: "no-endpoints", Severity: severityCritical, Category: categoryDegraded, Checker: "svc"},
+		{ID: "SVC009", Name: "no-ready-endpoints", Severity: severityCritical, Category: categoryDegraded, Checker: "svc"},
+		{ID: "DEP001", Name: "scaled-to-zero", Severity: severityInfo, Category: categoryOrphan, Checker: "dep"},
+		{ID: "DEP002", Name: "no-labels", Severity: severityWarning, Category: categoryMisconfiguration, Checker: "dep"},
+		{ID: "DEP003", Name: "minimum-replicas-unavailable", Severity: severityWarning, Category: categoryDegraded, Checker: "dep"},
+		{ID: "DEP004", Name: "progress-deadline-exceeded", Severity: severityError, Category: categoryDegraded, Checker: "dep"},
+		{ID: "DEP005", Name: "no-ready-replicas", Severity: severityCritical, Category: categoryDegraded, Checker: "dep"},
+	} {
+		registerRule(rule)
+	}
+}
+
+// severityRank returns the position of the severity in severities, or -1 if it is unknown.
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseSeverity(severity string) (string, error) {
+	if severity == "" || severityRank(severity) >= 0 {
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity %s, expected one of %v", severity, severities)
+}
+
+// applyRule fills in the rule name, severity and category of the violation from its rule ID.
+func applyRule(violation *InventoryViolation) {
+	rule, ok := rules[violation.Rule]
+	if !ok {
+		return
+	}
+	violation.RuleName = rule.Name
+	if severity := config.ruleSeverity(rule.ID); severity != "" {
+		violation.Severity = severity
+	}
+	if violation.Severity == "" {
+		violation.Severity = rule.Severity
+	}
+	if violation.Category == "" {
+		violation.Category = rule.Category
+	}
+}
+
+// filterViolations returns the violations the keep function accepts.
+func filterViolations(orphans map[string]ResourceInventoryList, keep func(violation InventoryViolation) bool) map[string]ResourceInventoryList {
+	filtered := make(map[string]ResourceInventoryList)
+	for namespace, inventoryList := range orphans {
+		for key, violation := range inventoryList.Items {
+			if !keep(violation) {
+				continue
+			}
+			items, ok := filtered[namespace]
+			if !ok {
+				items = ResourceInventoryList{Items: make(map[string]InventoryViolation)}
+			}
+			items.Items[key] = violation
+			filtered[namespace] = items
+		}
+	}
+	return filtered
+}
+
+// atLeastSeverity keeps the violations at or above the severity. A blank severity keeps everything.
+func atLeastSeverity(severity string) func(violation InventoryViolation) bool {
+	return func(violation InventoryViolation) bool {
+		return severityRank(violation.Severity) >= severityRank(severity)
+	}
+}
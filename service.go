@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb"
+	isd "github.com/jbenet/go-is-domain"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type serviceChecker struct{}
+
+func init() {
+	registerChecker(serviceChecker{}, "service", "services")
+}
+
+func (serviceChecker) Name() string        { return "svc" }
+func (serviceChecker) Description() string { return "validate service(s)" }
+func (serviceChecker) Kinds() []string {
+	return []string{kindService, kindPod, kindEndpoints, kindEndpointSlice}
+}
+
+func (serviceChecker) Check(ctx context.Context, snapshot *Snapshot) ([]InventoryViolation, error) {
+	violations := make([]InventoryViolation, 0)
+	services := snapshot.Services()
+	graph, err := snapshot.Graph()
+	if err != nil {
+		return nil, err
+	}
+
+	bar := pb.StartNew(len(services))
+	for _, service := range services {
+		bar.Increment()
+		// No selector on the service, i.e. calls cannot be routed unless its Endpoints are managed manually
+		if len(service.Spec.Selector) == 0 && service.Spec.Type != v1.ServiceTypeExternalName {
+			if !snapshot.EndpointsKnown() {
+				violations = append(violations, InventoryViolation{Rule: "SVC001", Reason: "no selector", Kind: kindService, Name: service.Name, Namespace: service.Namespace})
+				continue
+			}
+			endpoints, ok := snapshot.Endpoints(service.Namespace, service.Name)
+			if !ok {
+				violations = append(violations, InventoryViolation{Rule: "SVC001", Reason: "no selector and no Endpoints", Kind: kindService, Reference: ResourceReference{Kind: kindEndpoints, Name: service.Name}, Name: service.Name, Namespace: service.Namespace})
+				continue
+			}
+			ready, notReady := endpointsAddresses(endpoints)
+			if ready == 0 && notReady == 0 {
+				violations = append(violations, InventoryViolation{Rule: "SVC001", Reason: "no selector and its Endpoints have no addresses", Kind: kindService, Reference: ResourceReference{Kind: kindEndpoints, Name: service.Name}, Name: service.Name, Namespace: service.Namespace})
+			} else if ready == 0 {
+				violations = append(violations, InventoryViolation{Rule: "SVC009", Reason: fmt.Sprintf("all %d address(es) are not ready", notReady), Kind: kindService, Reference: ResourceReference{Kind: kindEndpoints, Name: service.Name}, Name: service.Name, Namespace: service.Namespace})
+			}
+			continue
+		}
+
+		if service.Spec.Type == v1.ServiceTypeLoadBalancer {
+			if len(service.Status.LoadBalancer.Ingress) == 0 && time.Since(service.CreationTimestamp.Time) >= config.Thresholds.loadBalancerPending {
+				violations = append(violations, InventoryViolation{Rule: "SVC002", Reason: "LoadBalancer service in pending state", Kind: kindService, Name: service.Name, Namespace: service.Namespace})
+
+			}
+			continue
+		}
+
+		if service.Spec.Type == v1.ServiceTypeExternalName {
+			if !isd.IsDomain(service.Spec.ExternalName) {
+				violations = append(violations, InventoryViolation{Rule: "SVC003", Reason: fmt.Sprintf("%s is not a valid CNAME", service.Spec.ExternalName), Kind: kindService, Name: service.Name, Namespace: service.Namespace})
+			}
+			continue
+		}
+
+		// The pods the service selects are the targets of its edges in the graph.
+		selector := labels.SelectorFromSet(service.Spec.Selector)
+		edges := graph.Out(graph.Node(kindService, service.Namespace, service.Name), relationSelects)
+		if len(edges) == 1 && edges[0].Broken {
+			violations = append(violations, InventoryViolation{Rule: "SVC004", Reason: "backing service references no workloads: " + edges[0].Reason, Kind: kindService, Name: service.Name, Namespace: service.Namespace})
+			continue
+		}
+		pods := make([]*v1.Pod, 0, len(edges))
+		for _, edge := range edges {
+			pods = append(pods, edge.To.object.(*v1.Pod))
+		}
+
+		if len(pods) == 0 {
+			violations = append(violations, InventoryViolation{Rule: "SVC005", Reason: "backing workload contains no pods", Kind: kindService, Reference: ResourceReference{Kind: kindPod, LabelSelector: selector.String()}, Name: service.Name, Namespace: service.Namespace})
+
+			continue
+		}
+
+		// A service is reported once per rule, so the ports that don't resolve are collected.
+		var undeclared, unnamed []string
+		for _, port := range service.Spec.Ports {
+			if declaresTargetPort(pods, port) {
+				continue
+			}
+			targetPort := serviceTargetPort(port)
+			if targetPort.Type == intstr.String {
+				unnamed = append(unnamed, servicePortName(port)+" -> "+targetPort.StrVal)
+			} else {
+				undeclared = append(undeclared, servicePortName(port)+" -> "+targetPort.String())
+			}
+		}
+		if len(unnamed) > 0 {
+			violations = append(violations, InventoryViolation{Rule: "SVC007", Reason: "no pod has a container port named after the target port of " + strings.Join(unnamed, ", "), Kind: kindService, Reference: ResourceReference{Kind: kindPod, LabelSelector: selector.String()}, Name: service.Name, Namespace: service.Namespace})
+		}
+		if len(undeclared) > 0 {
+			violations = append(violations, InventoryViolation{Rule: "SVC006", Reason: "no pod declares the target port of " + strings.Join(undeclared, ", "), Kind: kindService, Reference: ResourceReference{Kind: kindPod, LabelSelector: selector.String()}, Name: service.Name, Namespace: service.Namespace})
+		}
+
+		// Matching pods only receive traffic once they are ready, which the service addresses tell.
+		if !snapshot.EndpointsKnown() {
+			continue
+		}
+		ready, notReady, err := serviceAddresses(snapshot, service)
+		if err != nil {
+			return nil, err
+		}
+		if ready == 0 && notReady == 0 {
+			violations = append(violations, InventoryViolation{Rule: "SVC008", Reason: fmt.Sprintf("none of the %d matching pod(s) has an address", len(pods)), Kind: kindService, Reference: ResourceReference{Kind: kindEndpoints, Name: service.Name}, Name: service.Name, Namespace: service.Namespace})
+		} else if ready == 0 {
+			violations = append(violations, InventoryViolation{Rule: "SVC009", Reason: fmt.Sprintf("all %d address(es) are not ready", notReady), Kind: kindService, Reference: ResourceReference{Kind: kindEndpoints, Name: service.Name}, Name: service.Name, Namespace: service.Namespace})
+		}
+	}
+	bar.Finish()
+	return violations, nil
+}
+
+// serviceTargetPort returns the target port of the service port, which defaults to the port itself.
+func serviceTargetPort(port v1.ServicePort) intstr.IntOrString {
+	if port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "" {
+		return port.TargetPort
+	}
+	if port.TargetPort.IntVal != 0 {
+		return port.TargetPort
+	}
+	return intstr.FromInt(int(port.Port))
+}
+
+// servicePortName names the service port the way it is referenced, by name if it has one.
+func servicePortName(port v1.ServicePort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprint(port.Port)
+}
+
+// declaresTargetPort reports whether at least one of the pods has a container port, with the same
+// protocol, matching the target port of the service port by number or by name.
+func declaresTargetPort(pods []*v1.Pod, port v1.ServicePort) bool {
+	targetPort := serviceTargetPort(port)
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = v1.ProtocolTCP
+	}
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				containerProtocol := containerPort.Protocol
+				if containerProtocol == "" {
+					containerProtocol = v1.ProtocolTCP
+				}
+				if containerProtocol != protocol {
+					continue
+				}
+				if (targetPort.Type == intstr.Int && containerPort.ContainerPort == targetPort.IntVal) || (targetPort.Type == intstr.String && containerPort.Name == targetPort.StrVal) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/api/extensions/v1beta1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/pager"
+)
+
+const (
+	kindNamespace  = "namespace"
+	kindIngress    = "ingress"
+	kindService    = "service"
+	kindDeployment = "deployment"
+	kindPod        = "pod"
+	// kindIngressClass is only read by the ingress checker, to validate ingressClassName.
+	kindIngressClass = "ingressclass"
+	// kindEndpoints and kindEndpointSlice are read by the service checker for the service addresses.
+	kindEndpoints     = "endpoints"
+	kindEndpointSlice = "endpointslice"
+	// The workloads pods are owned by, read to link them in the dependency graph.
+	kindReplicaSet  = "replicaset"
+	kindDaemonSet   = "daemonset"
+	kindStatefulSet = "statefulset"
+)
+
+// kindResources maps the kinds to the API resources they are listed from. Versioned kinds are
+// resolved against the server with discoverResources, the versions here only name them offline.
+var kindResources = map[string]schema.GroupVersionResource{
+	kindNamespace:     {Group: "", Version: "v1", Resource: "namespaces"},
+	kindIngress:       {Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	kindIngressClass:  {Group: "networking.k8s.io", Version: "v1", Resource: "ingressclasses"},
+	kindService:       {Group: "", Version: "v1", Resource: "services"},
+	kindDeployment:    {Group: "apps", Version: "v1", Resource: "deployments"},
+	kindPod:           {Group: "", Version: "v1", Resource: "pods"},
+	kindEndpoints:     {Group: "", Version: "v1", Resource: "endpoints"},
+	kindEndpointSlice: {Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"},
+	kindReplicaSet:    {Group: "apps", Version: "v1", Resource: "replicasets"},
+	kindDaemonSet:     {Group: "apps", Version: "v1", Resource: "daemonsets"},
+	kindStatefulSet:   {Group: "apps", Version: "v1", Resource: "statefulsets"},
+}
+
+// apiClients are the clients a snapshot is listed with, and the API resources the server serves.
+type apiClients struct {
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	resources map[string]schema.GroupVersionResource
+}
+
+type listFunc func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error)
+
+// listUnstructured lists a versioned kind at the version the server serves.
+func listUnstructured(kind string) listFunc {
+	return func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.dynamic.Resource(clients.resources[kind]).Namespace(namespace).List(options)
+	}
+}
+
+// kindListers knows how to LIST every kind the checkers can ask for.
+var kindListers = map[string]listFunc{
+	// Only the selected namespace is read, accounts limited to it may not list the others.
+	kindNamespace: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		if namespace == "" {
+			return clients.clientset.CoreV1().Namespaces().List(options)
+		}
+		selected, err := clients.clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &v1.NamespaceList{Items: []v1.Namespace{*selected}}, nil
+	},
+	kindIngress:      listUnstructured(kindIngress),
+	kindIngressClass: listUnstructured(kindIngressClass),
+	kindService: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.CoreV1().Services(namespace).List(options)
+	},
+	kindDeployment: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.AppsV1().Deployments(namespace).List(options)
+	},
+	kindPod: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.CoreV1().Pods(namespace).List(options)
+	},
+	kindEndpoints: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.CoreV1().Endpoints(namespace).List(options)
+	},
+	kindEndpointSlice: listUnstructured(kindEndpointSlice),
+	kindReplicaSet: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.AppsV1().ReplicaSets(namespace).List(options)
+	},
+	kindDaemonSet: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.AppsV1().DaemonSets(namespace).List(options)
+	},
+	kindStatefulSet: func(clients *apiClients, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+		return clients.clientset.AppsV1().StatefulSets(namespace).List(options)
+	},
+}
+
+// Snapshot is an in-memory copy of the cluster state of the selected namespace(s). Every kind is
+// listed once and indexed by namespace/name, so checkers resolve references without calling the API server.
+type Snapshot struct {
+	Namespace string
+	indexers  map[string]cache.Indexer
+	// errors lists the requests the API server refused. failed records per kind the namespaces it
+	// couldn't be listed in, blank standing for all of them.
+	errors []ReportError
+	failed map[string]map[string]bool
+	// resources are the API resources the cluster serves, nil for snapshots read from files.
+	resources map[string]schema.GroupVersionResource
+	// graph is built from the objects on first use.
+	graph *Graph
+}
+
+func newSnapshot(namespace string) *Snapshot {
+	return &Snapshot{Namespace: namespace, indexers: make(map[string]cache.Indexer), failed: make(map[string]map[string]bool)}
+}
+
+// loadSnapshot lists each of the requested kinds once, in pages, and indexes the results. Kinds the
+// API server refuses to list are recorded and skipped; when a cluster-wide list is forbidden, the kind
+// is listed namespace by namespace instead. Only failures to reach the API server are returned.
+func loadSnapshot(ctx context.Context, clients *apiClients, namespace string, kinds []string) (*Snapshot, error) {
+	snapshot := newSnapshot(namespace)
+	snapshot.resources = clients.resources
+	for _, kind := range kinds {
+		if _, ok := kindListers[kind]; !ok {
+			return nil, fmt.Errorf("don't know how to list %s", kind)
+		}
+		if _, loaded := snapshot.indexers[kind]; loaded {
+			continue
+		}
+		if _, served := clients.resources[kind]; !served {
+			log.Printf("The cluster doesn't serve %ss, skipping them.\n", kind)
+			continue
+		}
+		err := snapshot.list(ctx, clients, kind, namespace)
+		if err == nil {
+			continue
+		}
+		if _, ok := apiStatus(err); !ok {
+			return nil, fmt.Errorf("unable to retrieve %ss: %w", kind, err)
+		}
+		if !apierrors.IsForbidden(err) || namespace != "" || kind == kindNamespace || snapshot.incomplete(kindNamespace, "") {
+			verb := "list"
+			if kind == kindNamespace && namespace != "" {
+				verb = "get"
+			}
+			snapshot.recordFailure(verb, kind, namespace, err)
+			continue
+		}
+
+		log.Printf("Listing %ss across the cluster is forbidden, listing them per namespace.\n", kind)
+		for _, ns := range snapshot.Namespaces() {
+			err := snapshot.list(ctx, clients, kind, ns.Name)
+			if err == nil {
+				continue
+			}
+			if _, ok := apiStatus(err); !ok {
+				return nil, fmt.Errorf("unable to retrieve %ss in %s: %w", kind, ns.Name, err)
+			}
+			snapshot.recordFailure("list", kind, ns.Name, err)
+		}
+	}
+	return snapshot, nil
+}
+
+// list adds the objects of the kind in the namespace, or in all namespaces if blank, to the snapshot.
+func (s *Snapshot) list(ctx context.Context, clients *apiClients, kind string, namespace string) error {
+	list := kindListers[kind]
+	indexer := s.indexer(kind)
+	listPager := pager.New(pager.SimplePageFunc(func(options metav1.ListOptions) (runtime.Object, error) {
+		return list(clients, namespace, options)
+	}))
+	return listPager.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		return indexer.Add(obj)
+	})
+}
+
+// addManifest adds an object read from a manifest to the snapshot. It returns false for objects the
+// checkers have no use for. Namespaced objects without a namespace land in the selected (or default) one.
+func (s *Snapshot) addManifest(obj runtime.Object) bool {
+	var kind string
+	switch typed := obj.(type) {
+	case *v1.Namespace:
+		kind = kindNamespace
+	case *v1beta1.Ingress, *networkingv1beta1.Ingress:
+		// Ingresses are kept unstructured whatever their version, like the ones listed from a cluster.
+		ingress, err := toUnstructured(obj)
+		if err != nil {
+			return false
+		}
+		obj, kind = ingress, kindIngress
+	case *discoveryv1beta1.EndpointSlice:
+		slice, err := toUnstructured(obj)
+		if err != nil {
+			return false
+		}
+		obj, kind = slice, kindEndpointSlice
+	case *unstructured.Unstructured:
+		switch typed.GetKind() {
+		case "Ingress":
+			kind = kindIngress
+		case "IngressClass":
+			kind = kindIngressClass
+		case "EndpointSlice":
+			kind = kindEndpointSlice
+		default:
+			return false
+		}
+	case *v1.Service:
+		kind = kindService
+	case *v1apps.Deployment:
+		kind = kindDeployment
+	case *v1apps.ReplicaSet:
+		kind = kindReplicaSet
+	case *v1apps.DaemonSet:
+		kind = kindDaemonSet
+	case *v1apps.StatefulSet:
+		kind = kindStatefulSet
+	case *v1.Pod:
+		kind = kindPod
+	case *v1.Endpoints:
+		kind = kindEndpoints
+	default:
+		return false
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	clusterScoped := kind == kindNamespace || kind == kindIngressClass
+	if !clusterScoped && accessor.GetNamespace() == "" {
+		if s.Namespace != "" {
+			accessor.SetNamespace(s.Namespace)
+		} else {
+			accessor.SetNamespace(metav1.NamespaceDefault)
+		}
+	}
+	if s.Namespace != "" && !clusterScoped && accessor.GetNamespace() != s.Namespace {
+		return false
+	}
+	s.indexer(kind).Add(obj)
+	return true
+}
+
+func (s *Snapshot) indexer(kind string) cache.Indexer {
+	indexer, ok := s.indexers[kind]
+	if !ok {
+		indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		s.indexers[kind] = indexer
+	}
+	return indexer
+}
+
+// objects returns every object of the kind, sorted by namespace/name so reports are stable.
+func (s *Snapshot) objects(kind string) []interface{} {
+	indexer := s.indexer(kind)
+	keys := indexer.ListKeys()
+	sort.Strings(keys)
+	objects := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		obj, exists, _ := indexer.GetByKey(key)
+		if exists {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// object returns the metadata of the object of the kind, or nil if the snapshot doesn't have it.
+func (s *Snapshot) object(kind string, namespace string, name string) metav1.Object {
+	key := name
+	if kind != kindNamespace && kind != kindIngressClass {
+		key = namespace + "/" + name
+	}
+	obj, exists, _ := s.indexer(kind).GetByKey(key)
+	if !exists {
+		return nil
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	return accessor
+}
+
+// identify records the UID and resourceVersion of the object the violation was found on.
+func (s *Snapshot) identify(violation *InventoryViolation) {
+	if obj := s.object(violation.Kind, violation.Namespace, violation.Name); obj != nil {
+		violation.UID = string(obj.GetUID())
+		violation.ResourceVersion = obj.GetResourceVersion()
+	}
+}
+
+func (s *Snapshot) Namespaces() []*v1.Namespace {
+	objects := s.objects(kindNamespace)
+	namespaces := make([]*v1.Namespace, 0, len(objects))
+	for _, obj := range objects {
+		namespaces = append(namespaces, obj.(*v1.Namespace))
+	}
+	return namespaces
+}
+
+// Ingresses returns the ingresses of every API version in their version independent form.
+func (s *Snapshot) Ingresses() ([]*Ingress, error) {
+	objects := s.objects(kindIngress)
+	ingresses := make([]*Ingress, 0, len(objects))
+	for _, obj := range objects {
+		ingress := &Ingress{}
+		if err := convertObject(obj.(*unstructured.Unstructured).Object, ingress); err != nil {
+			return nil, err
+		}
+		ingresses = append(ingresses, ingress)
+	}
+	return ingresses, nil
+}
+
+// IngressClassesKnown tells whether the ingress classes are known: the cluster serves them and they
+// could be listed, or for snapshots read from files, some are present. Ingress classes are usually
+// not part of application manifests, so their absence there says nothing.
+func (s *Snapshot) IngressClassesKnown() bool {
+	if s.resources == nil {
+		return len(s.objects(kindIngressClass)) > 0
+	}
+	_, served := s.resources[kindIngressClass]
+	return served && !s.incomplete(kindIngressClass, "")
+}
+
+func (s *Snapshot) IngressClass(name string) bool {
+	_, exists, _ := s.indexer(kindIngressClass).GetByKey(name)
+	return exists
+}
+
+// resource returns the API resource the kind is served from.
+func (s *Snapshot) resource(kind string) schema.GroupVersionResource {
+	if resource, ok := s.resources[kind]; ok {
+		return resource
+	}
+	return kindResources[kind]
+}
+
+func (s *Snapshot) Services() []*v1.Service {
+	objects := s.objects(kindService)
+	services := make([]*v1.Service, 0, len(objects))
+	for _, obj := range objects {
+		services = append(services, obj.(*v1.Service))
+	}
+	return services
+}
+
+func (s *Snapshot) Deployments() []*v1apps.Deployment {
+	objects := s.objects(kindDeployment)
+	deployments := make([]*v1apps.Deployment, 0, len(objects))
+	for _, obj := range objects {
+		deployments = append(deployments, obj.(*v1apps.Deployment))
+	}
+	return deployments
+}
+
+// DaemonSets returns the daemon sets, which only the dependency graph reads.
+func (s *Snapshot) DaemonSets() []*v1apps.DaemonSet {
+	objects := s.objects(kindDaemonSet)
+	daemonSets := make([]*v1apps.DaemonSet, 0, len(objects))
+	for _, obj := range objects {
+		daemonSets = append(daemonSets, obj.(*v1apps.DaemonSet))
+	}
+	return daemonSets
+}
+
+// StatefulSets returns the stateful sets, which only the dependency graph reads.
+func (s *Snapshot) StatefulSets() []*v1apps.StatefulSet {
+	objects := s.objects(kindStatefulSet)
+	statefulSets := make([]*v1apps.StatefulSet, 0, len(objects))
+	for _, obj := range objects {
+		statefulSets = append(statefulSets, obj.(*v1apps.StatefulSet))
+	}
+	return statefulSets
+}
+
+func (s *Snapshot) Service(namespace string, name string) (*v1.Service, error) {
+	return corelisters.NewServiceLister(s.indexer(kindService)).Services(namespace).Get(name)
+}
+
+// Pods returns the pods in the namespace matching the label selector.
+func (s *Snapshot) Pods(namespace string, selector labels.Selector) ([]*v1.Pod, error) {
+	return corelisters.NewPodLister(s.indexer(kindPod)).Pods(namespace).List(selector)
+}
+
+// EndpointsKnown tells whether the service addresses are known: always for a cluster, and for
+// snapshots read from files when they hold Endpoints or EndpointSlices.
+func (s *Snapshot) EndpointsKnown() bool {
+	if s.resources == nil {
+		return len(s.objects(kindEndpoints)) > 0 || len(s.objects(kindEndpointSlice)) > 0
+	}
+	return true
+}
+
+// EndpointSlicesKnown tells whether the service addresses are read from EndpointSlices: the cluster
+// serves them, or for snapshots read from files, some are present.
+func (s *Snapshot) EndpointSlicesKnown() bool {
+	if s.resources == nil {
+		return len(s.objects(kindEndpointSlice)) > 0
+	}
+	_, served := s.resources[kindEndpointSlice]
+	return served
+}
+
+// Endpoints returns the Endpoints object of the service, or false if there is none.
+func (s *Snapshot) Endpoints(namespace string, name string) (*v1.Endpoints, bool) {
+	endpoints, err := corelisters.NewEndpointsLister(s.indexer(kindEndpoints)).Endpoints(namespace).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return endpoints, true
+}
+
+// EndpointSlices returns the EndpointSlices of the service, of either API version, in their
+// version independent form.
+func (s *Snapshot) EndpointSlices(namespace string, service string) ([]*EndpointSlice, error) {
+	selector := labels.SelectorFromSet(labels.Set{endpointSliceServiceLabel: service})
+	objects := make([]interface{}, 0)
+	if err := cache.ListAllByNamespace(s.indexer(kindEndpointSlice), namespace, selector, func(obj interface{}) {
+		objects = append(objects, obj)
+	}); err != nil {
+		return nil, err
+	}
+	slices := make([]*EndpointSlice, 0, len(objects))
+	for _, obj := range objects {
+		slice := &EndpointSlice{}
+		if err := convertObject(obj.(*unstructured.Unstructured).Object, slice); err != nil {
+			return nil, err
+		}
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// annotationIgnore lists the rule IDs not to report on the object, or all of them with "all".
+	// On a namespace it applies to every object in it.
+	annotationIgnore = "kube-cleanup.io/ignore"
+	// annotationIgnoreUntil optionally ends the suppression at a date (2006-01-02) or time (RFC 3339).
+	annotationIgnoreUntil = "kube-cleanup.io/ignore-until"
+)
+
+// suppressedBy tells whether the annotations of the object suppress the rule, and describes the
+// suppression if they do.
+func suppressedBy(obj metav1.Object, kind string, rule string, now time.Time) (string, bool) {
+	if obj == nil {
+		return "", false
+	}
+	annotations := obj.GetAnnotations()
+	ignore, ok := annotations[annotationIgnore]
+	if !ok {
+		return "", false
+	}
+
+	matched := false
+	for _, id := range strings.Split(ignore, ",") {
+		id = strings.TrimSpace(id)
+		if strings.EqualFold(id, "all") || (id != "" && id == rule) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return "", false
+	}
+
+	description := fmt.Sprintf("%s on %s %s", annotationIgnore, kind, obj.GetName())
+	if until, ok := annotations[annotationIgnoreUntil]; ok {
+		expiry, err := parseExpiry(until)
+		if err != nil {
+			log.Printf("Ignoring the suppression on %s %s: %s\n", kind, obj.GetName(), err.Error())
+			return "", false
+		}
+		if !now.Before(expiry) {
+			return "", false
+		}
+		description += " until " + until
+	}
+	return description, true
+}
+
+func parseExpiry(value string) (time.Time, error) {
+	if expiry, err := time.Parse("2006-01-02", value); err == nil {
+		return expiry, nil
+	}
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return expiry, fmt.Errorf("%s is neither a date (2006-01-02) nor a RFC 3339 time", value)
+	}
+	return expiry, nil
+}
+
+// suppression checks the annotations of the object the violation was found on, and then those of
+// its namespace.
+func (s *Snapshot) suppression(violation InventoryViolation, now time.Time) (string, bool) {
+	if description, ok := suppressedBy(s.object(violation.Kind, violation.Namespace, violation.Name), violation.Kind, violation.Rule, now); ok {
+		return description, true
+	}
+	if violation.Kind == kindNamespace {
+		return "", false
+	}
+	return suppressedBy(s.object(kindNamespace, "", violation.Namespace), kindNamespace, violation.Rule, now)
+}